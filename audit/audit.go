@@ -0,0 +1,194 @@
+// Package audit keeps an append-only record of the requests made to the database.
+//
+// Entries are written as JSON lines to audit.log in the log's directory. Once the file
+// grows past its size limit it is renamed to audit-<time>.log and a new file is started;
+// rotated files are never changed or removed.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// currentFile is the name of the file entries are appended to.
+const currentFile = "audit.log"
+
+// rotatedTime is the layout of the time in the name of a rotated file. It sorts in
+// chronological order.
+const rotatedTime = "20060102T150405.000000000"
+
+// An Entry records one request.
+type Entry struct {
+	Time          time.Time `json:"time"`
+	User          string    `json:"user"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	Bytes         int64     `json:"bytes"`                   // Size of the response body
+	VersionBefore uint64    `json:"versionBefore,omitempty"` // Document version before the request, 0 if none
+	VersionAfter  uint64    `json:"versionAfter,omitempty"`  // Document version after the request, 0 if none
+}
+
+// A Filter selects entries. Empty fields match every entry.
+type Filter struct {
+	User  string    // Exact user
+	Path  string    // Prefix of the path
+	Since time.Time // Earliest time
+}
+
+// matches reports whether the entry is selected by the filter.
+func (f Filter) matches(entry Entry) bool {
+	return (f.User == "" || entry.User == f.User) &&
+		strings.HasPrefix(entry.Path, f.Path) &&
+		!entry.Time.Before(f.Since)
+}
+
+// A Log appends entries to a rotating file. It is safe for concurrent use.
+type Log struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64 // Size after which the file is rotated
+	file     *os.File
+	size     int64
+}
+
+// Open opens the audit log in dir, creating the directory if needed. The current file is
+// rotated once it exceeds maxBytes.
+func Open(dir string, maxBytes int64) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, maxBytes: maxBytes}
+	if err := l.openCurrent(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// openCurrent opens the current file for appending. The caller must hold l.mu, unless
+// the log is still being opened.
+func (l *Log) openCurrent() error {
+	file, err := os.OpenFile(filepath.Join(l.dir, currentFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends an entry to the log.
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate renames the current file and starts a new one. The caller must hold l.mu.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	rotated := fmt.Sprintf("audit-%s.log", time.Now().UTC().Format(rotatedTime))
+	if err := os.Rename(filepath.Join(l.dir, currentFile), filepath.Join(l.dir, rotated)); err != nil {
+		return err
+	}
+	return l.openCurrent()
+}
+
+// Query returns the entries selected by the filter, oldest first. The lock is only held
+// while the files to read are listed, so requests are not held up by the reading.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	rotated, current, size, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer current.Close()
+
+	entries := []Entry{}
+	for _, name := range rotated {
+		entries, err = readFile(name, filter, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return readEntries(currentFile, io.LimitReader(current, size), filter, entries)
+}
+
+// snapshot lists the rotated files in order, and opens the current file along with its
+// size. Rotated files never change, and the current file stays open even if it is rotated
+// afterwards, so they can be read without holding l.mu.
+func (l *Log) snapshot() ([]string, *os.File, int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rotated, err := filepath.Glob(filepath.Join(l.dir, "audit-*.log"))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	sort.Strings(rotated)
+	current, err := os.Open(filepath.Join(l.dir, currentFile))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return rotated, current, l.size, nil
+}
+
+// readFile appends the entries of the named file selected by the filter to entries.
+func readFile(name string, filter Filter, entries []Entry) ([]Entry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readEntries(filepath.Base(name), file, filter, entries)
+}
+
+// readEntries appends the entries read from the file with the given name that are selected
+// by the filter to entries.
+func readEntries(name string, file io.Reader, filter Filter, entries []Entry) ([]Entry, error) {
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("corrupt audit entry in %s: %w", name, err)
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Close closes the current file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestLog opens a log in a temporary directory and closes it when the test ends.
+func openTestLog(t *testing.T, maxBytes int64) (*Log, string) {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := Open(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, dir
+}
+
+func TestQueryFilters(t *testing.T) {
+	l, _ := openTestLog(t, 1<<20)
+	start := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: start, User: "alice", Method: "PUT", Path: "/v1/db/a", Status: 201},
+		{Time: start.Add(time.Minute), User: "bob", Method: "GET", Path: "/v1/db/a", Status: 200},
+		{Time: start.Add(2 * time.Minute), User: "alice", Method: "GET", Path: "/v1/other", Status: 404},
+	}
+	for _, entry := range entries {
+		if err := l.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter Filter
+		want   int
+	}{
+		{Filter{}, 3},
+		{Filter{User: "alice"}, 2},
+		{Filter{Path: "/v1/db"}, 2},
+		{Filter{Since: start.Add(time.Minute)}, 2},
+		{Filter{User: "alice", Path: "/v1/db", Since: start.Add(time.Second)}, 0},
+	}
+	for _, test := range tests {
+		got, err := l.Query(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != test.want {
+			t.Errorf("Query(%+v) returned %d entries, want %d", test.filter, len(got), test.want)
+		}
+	}
+}
+
+func TestRotationKeepsEveryEntry(t *testing.T) {
+	// Every entry is larger than the limit, so each one after the first rotates the file.
+	l, dir := openTestLog(t, 10)
+	for i := 0; i < 3; i++ {
+		if err := l.Record(Entry{Time: time.Unix(int64(i), 0), User: "alice", Path: "/v1/db"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Errorf("Expected 2 rotated files, got %v", rotated)
+	}
+
+	entries, err := l.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries across the rotated files, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Time.Unix() != int64(i) {
+			t.Errorf("Entry %d is from %v, want the entries oldest first", i, entry.Time)
+		}
+	}
+}
+
+func TestReopenAppends(t *testing.T) {
+	l, dir := openTestLog(t, 1<<20)
+	if err := l.Record(Entry{User: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	reopened, err := Open(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if err := reopened.Record(Entry{User: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := reopened.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected both entries after reopening, got %+v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dir, currentFile)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryWhileRecording(t *testing.T) {
+	// Small files, so that the current file is rotated while queries read it.
+	l, _ := openTestLog(t, 200)
+	const writes = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < writes; i++ {
+			if err := l.Record(Entry{Time: time.Unix(int64(i), 0), User: "alice"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	seen := 0
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		entries, err := l.Query(Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) < seen {
+			t.Fatalf("Query returned %d entries after returning %d", len(entries), seen)
+		}
+		seen = len(entries)
+	}
+	if seen != writes {
+		t.Errorf("Expected %d entries once recording finished, got %d", writes, seen)
+	}
+}
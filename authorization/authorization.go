@@ -3,18 +3,15 @@
 package authorization
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"io"
 	"log/slog"
-	"math/rand"
+	"math/big"
 	"net/http"
-	"os"
 	"time"
 )
 
-// Initialize a random number generator with a time-based seed
-var seed = rand.New(rand.NewSource(time.Now().UnixNano()))
-
 // Define parameters of token for generation:
 // charset is a set of characters to choose to make the token out of
 // tokenLen is the number of characters the token will be made of
@@ -22,9 +19,13 @@ var seed = rand.New(rand.NewSource(time.Now().UnixNano()))
 const charset = "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz0123456789"
 const tokenLen = 15
 
+// tokenLifetime is how long a token handed out by /auth stays valid.
+const tokenLifetime = 1 * time.Hour
+
 // authHandler struct, which contains operations which only act on /auth
 type AuthHandler struct {
-	tokenStore map[string]string
+	sessions *sessionStore
+	jwt      *jwtVerifier // Verifies signed tokens, nil if they are not accepted
 }
 
 // userFormat to unmarshal user data into
@@ -32,27 +33,33 @@ type UserFormat struct {
 	Username string
 }
 
-// creates a new authHandler with a token store initialized
+// creates a new authHandler with a session store initialized
 func NewAuth() *AuthHandler {
 	a := new(AuthHandler)
-	a.tokenStore = make(map[string]string)
+	a.sessions = newSessionStore()
 	return a
 }
 
-// Function to generate a random token
-func (auth AuthHandler) makeToken() string {
+// Function to generate a random token. Tokens are bearer credentials, so their
+// characters come from a cryptographically secure source.
+func (auth *AuthHandler) makeToken() (string, error) {
 	token := make([]byte, tokenLen) // Initialize a byte array to hold the token
+	max := big.NewInt(int64(len(charset)))
 	for i := range token {
-		token[i] = charset[seed.Intn(len(charset))] // Populate token with random characters from charset
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		token[i] = charset[n.Int64()] // Populate token with random characters from charset
 	}
-	slog.Info("Token made" + string(token))
-	return string(token) // Convert byte array to string and return
+	slog.Info("Token made")
+	return string(token), nil // Convert byte array to string and return
 }
 
 // HTTP handler function for authentication
-func (auth AuthHandler) HandleAuthFunctions(w http.ResponseWriter, r *http.Request) {
-	slog.Info("Auth Method Called ", r.Method)
-	slog.Info("Path ", r.URL.Path)
+func (auth *AuthHandler) HandleAuthFunctions(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Auth Method Called", "method", r.Method)
+	slog.Info("Auth path", "path", r.URL.Path)
 	logHeader(r)
 
 	//Switch between types of methods
@@ -77,7 +84,7 @@ func (auth AuthHandler) HandleAuthFunctions(w http.ResponseWriter, r *http.Reque
 
 // Handles options request to /auth
 // Writes header for preflight request
-func (auth AuthHandler) authOptions(w http.ResponseWriter, r *http.Request) {
+func (auth *AuthHandler) authOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Allow", "POST,DELETE")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE")
@@ -131,11 +138,24 @@ func (auth *AuthHandler) authPost(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Username exists")
 
 	// ALSO NEED TO CHECK if user exists in the database here? or are all names valid?
-	token := auth.makeToken() // Generate a new token
-	time.AfterFunc(1*time.Hour, func() { delete(auth.tokenStore, token) })
-
-	auth.tokenStore[token] = d.Username // Store the token and other info
-	slog.Info(auth.tokenStore[token])
+	var token string
+	if auth.jwt != nil && auth.jwt.mint {
+		// Signed tokens carry the user themselves, so nothing is stored.
+		token, err = auth.jwt.mintToken(d.Username, time.Now(), tokenLifetime)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Signed token issued", "user", d.Username)
+	} else {
+		token, err = auth.makeToken() // Generate a new token
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auth.sessions.add(token, d.Username, time.Now().Add(tokenLifetime))
+		slog.Info("Token stored", "user", d.Username)
+	}
 	// Respond with the generated token
 	response := marshalToken(token)
 
@@ -148,26 +168,24 @@ func (auth *AuthHandler) authPost(w http.ResponseWriter, r *http.Request) {
 func (auth *AuthHandler) authDelete(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Access-Control-Allow-Origin", "*")
 
-	//Checks user authorization
-	if r.Header.Get("Authorization") == "" {
+	//Checks user authorization, then deletes the token
+	token, ok := bearerToken(r.Header.Get("Authorization"))
+	if !ok {
 		w.Header().Add("WWW-Authenticate", "Bearer")
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-
-	token := r.Header.Get("Authorization")[7:]
-
-	//Checks that token is in tokenStore
-	if auth.CheckToken(r.Header.Get("Authorization")) != true {
+	if _, ok := auth.sessions.lookup(token); ok {
+		auth.sessions.remove(token)
+	} else if claims, ok := auth.verifySigned(token); ok {
+		// A signed token cannot be deleted, so it is remembered as revoked until it
+		// expires.
+		auth.sessions.revoke(token, time.Unix(claims.Exp, 0).Add(jwtLeeway))
+	} else {
 		w.Header().Add("WWW-Authenticate", "Bearer")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-
-	//Deletes token
-	delete(auth.tokenStore, token)
-	slog.Info(auth.tokenStore[token])
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -183,43 +201,51 @@ func marshalToken(token string) []byte {
 	return response
 }
 
-// simple function to check that the given token is in the tokenStore
-func (auth *AuthHandler) CheckToken(token string) bool {
-	slog.Info(token)
-	for k, v := range auth.tokenStore {
-		slog.Info(k, v)
-		if token[7:] == k {
-			if v != "" {
-				return true
-			}
-		}
-	}
-	return false
+// CheckToken reports whether the given Authorization header holds a bearer token that
+// is in the session store and has not expired.
+func (auth *AuthHandler) CheckToken(header string) bool {
+	_, ok := auth.Username(header)
+	return ok
 }
 
-// Reads the token file into tokenStore
-func (auth *AuthHandler) handleTokenFile(path string) {
-	dat, err := os.ReadFile(path)
-	if err != nil {
-		slog.Info("Token file could not be read")
-		return
+// Username returns the user that the bearer token in the given Authorization header
+// belongs to, and false if the header is malformed or the token is unknown or expired.
+func (auth *AuthHandler) Username(header string) (string, bool) {
+	token, ok := bearerToken(header)
+	if !ok {
+		return "", false
 	}
+	if user, ok := auth.sessions.lookup(token); ok {
+		return user, true
+	}
+	claims, ok := auth.verifySigned(token)
+	return claims.Sub, ok
+}
 
-	var tokens map[string]string
-	err = json.Unmarshal(dat, &tokens)
+// verifySigned returns the claims of a valid signed token that has not been revoked, and
+// false for any other token or if signed tokens are not accepted.
+func (auth *AuthHandler) verifySigned(token string) (jwtClaims, bool) {
+	if auth.jwt == nil || !looksLikeJWT(token) {
+		return jwtClaims{}, false
+	}
+	claims, err := auth.jwt.verify(token, time.Now())
 	if err != nil {
-		slog.Info("Unmarshal Failed")
-		return
+		slog.Info("Signed token rejected", "error", err)
+		return jwtClaims{}, false
 	}
-
-	for user, token := range tokens {
-		auth.tokenStore[token] = user
+	if auth.sessions.revoked(token) {
+		return jwtClaims{}, false
 	}
+	return claims, true
 }
 
+// logHeader logs the request headers, leaving out credentials.
 func logHeader(r *http.Request) {
 	for key, element := range r.Header {
-		slog.Info("Header:", key, "Value", element)
+		if key == "Authorization" {
+			continue
+		}
+		slog.Info("Header", "key", key, "value", element)
 	}
 }
 
@@ -227,5 +253,4 @@ func logHeader(r *http.Request) {
 // http.HandleFunc("/auth", authorization.authHandler)  // Route /auth URL path to authHandler function if /auth in URL
 // need to do OPTIONS ad well
 // Use LOGGING
-// need to check for token expiration each time for all incoming requests with the token in the header
 // UserStruct with token and username
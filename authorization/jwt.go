@@ -0,0 +1,179 @@
+package authorization
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jwtLeeway is the clock skew allowed when checking the expiry and not-before claims.
+const jwtLeeway = 30 * time.Second
+
+// A jwtVerifier checks, and optionally issues, JSON Web Tokens signed with HMAC SHA-256
+// using a shared secret.
+type jwtVerifier struct {
+	secret   []byte
+	audience string // Audience tokens must be issued for, "" to accept any
+	mint     bool   // Whether /auth hands out signed tokens instead of random ones
+}
+
+// jwtHeader is the JOSE header of a token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// jwtClaims are the registered claims OwlDB reads. Times are in seconds since the Unix
+// epoch.
+type jwtClaims struct {
+	Sub string   `json:"sub"`
+	Aud audience `json:"aud,omitempty"`
+	Exp int64    `json:"exp,omitempty"`
+	Nbf int64    `json:"nbf,omitempty"`
+	Iat int64    `json:"iat,omitempty"`
+}
+
+// An audience is the aud claim, which may be a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var several []string
+	if err := json.Unmarshal(data, &several); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = several
+	return nil
+}
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// EnableJWT makes the server accept tokens signed with HS256 using the secret in the file
+// at secretPath, alongside its own random tokens. The token's sub claim is the user, and
+// it must have an exp claim. If aud is not empty, tokens must name it in their aud claim.
+// If mint is true, /auth hands out signed tokens instead of random ones.
+func (auth *AuthHandler) EnableJWT(secretPath string, aud string, mint bool) error {
+	secret, err := os.ReadFile(secretPath)
+	if err != nil {
+		return err
+	}
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return errors.New("JWT secret file is empty")
+	}
+	auth.jwt = &jwtVerifier{secret: secret, audience: aud, mint: mint}
+	return nil
+}
+
+// looksLikeJWT reports whether a bearer token has the three dot separated parts of a
+// JSON Web Token. Random tokens never contain dots, but tokens from a token file may, so
+// the session store is consulted before a token is verified as signed.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// sign returns the signature of the token's header and payload.
+func (v *jwtVerifier) sign(signingInput string) []byte {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// verify checks a token's signature and claims at the given time, and returns its claims.
+// Tokens must expire, so that a revoked token only has to be remembered until it does.
+func (v *jwtVerifier) verify(token string, now time.Time) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return jwtClaims{}, err
+	}
+	// Only HS256 is accepted, so a token cannot pick a weaker algorithm or "none".
+	if header.Alg != "HS256" {
+		return jwtClaims{}, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, errors.New("malformed signature")
+	}
+	if !hmac.Equal(signature, v.sign(parts[0]+"."+parts[1])) {
+		return jwtClaims{}, errors.New("invalid signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return jwtClaims{}, err
+	}
+	switch {
+	case claims.Sub == "":
+		return jwtClaims{}, errors.New("missing sub claim")
+	case claims.Exp == 0:
+		return jwtClaims{}, errors.New("missing exp claim")
+	case !now.Before(time.Unix(claims.Exp, 0).Add(jwtLeeway)):
+		return jwtClaims{}, errors.New("token has expired")
+	case claims.Nbf != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.Nbf, 0)):
+		return jwtClaims{}, errors.New("token is not valid yet")
+	case v.audience != "" && !slices.Contains(claims.Aud, v.audience):
+		return jwtClaims{}, errors.New("token is for another audience")
+	}
+	return claims, nil
+}
+
+// mintToken issues a token for the user that expires after the given lifetime.
+func (v *jwtVerifier) mintToken(user string, now time.Time, lifetime time.Duration) (string, error) {
+	claims := jwtClaims{Sub: user, Iat: now.Unix(), Exp: now.Add(lifetime).Unix()}
+	if v.audience != "" {
+		claims.Aud = audience{v.audience}
+	}
+	header, err := encodeSegment(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + payload
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(v.sign(signingInput)), nil
+}
+
+// decodeSegment decodes a base64url encoded JSON part of a token into v.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	return nil
+}
+
+// encodeSegment encodes v as a base64url encoded JSON part of a token.
+func encodeSegment(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,147 @@
+package authorization
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newJWTAuth returns an AuthHandler accepting tokens signed with the secret "secret" for
+// the audience "owldb".
+func newJWTAuth(t *testing.T, mint bool) *AuthHandler {
+	t.Helper()
+	auth := newTestAuth(t)
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.EnableJWT(path, "owldb", mint); err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// signToken returns a token with the given header and claims, signed by the verifier.
+func signToken(t *testing.T, v *jwtVerifier, header jwtHeader, claims jwtClaims) string {
+	t.Helper()
+	h, err := encodeSegment(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := encodeSegment(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h + "." + c + "." + base64.RawURLEncoding.EncodeToString(v.sign(h+"."+c))
+}
+
+func TestVerifyClaims(t *testing.T) {
+	auth := newJWTAuth(t, false)
+	now := time.Unix(1700000000, 0)
+	hs256 := jwtHeader{Alg: "HS256", Typ: "JWT"}
+	valid := jwtClaims{Sub: "alice", Aud: audience{"owldb"}, Exp: now.Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name   string
+		header jwtHeader
+		edit   func(*jwtClaims)
+		ok     bool
+	}{
+		{"valid", hs256, func(*jwtClaims) {}, true},
+		{"audience in a list", hs256, func(c *jwtClaims) { c.Aud = audience{"other", "owldb"} }, true},
+		{"expired within leeway", hs256, func(c *jwtClaims) { c.Exp = now.Add(-jwtLeeway / 2).Unix() }, true},
+		{"missing exp", hs256, func(c *jwtClaims) { c.Exp = 0 }, false},
+		{"expired", hs256, func(c *jwtClaims) { c.Exp = now.Add(-time.Hour).Unix() }, false},
+		{"not valid yet", hs256, func(c *jwtClaims) { c.Nbf = now.Add(time.Hour).Unix() }, false},
+		{"other audience", hs256, func(c *jwtClaims) { c.Aud = audience{"other"} }, false},
+		{"missing audience", hs256, func(c *jwtClaims) { c.Aud = nil }, false},
+		{"missing sub", hs256, func(c *jwtClaims) { c.Sub = "" }, false},
+		{"none algorithm", jwtHeader{Alg: "none"}, func(*jwtClaims) {}, false},
+		{"other algorithm", jwtHeader{Alg: "HS512"}, func(*jwtClaims) {}, false},
+	}
+	for _, test := range tests {
+		claims := valid
+		test.edit(&claims)
+		_, err := auth.jwt.verify(signToken(t, auth.jwt, test.header, claims), now)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: verify returned %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+
+	token := signToken(t, auth.jwt, hs256, valid)
+	forged := token[:strings.LastIndex(token, ".")+1] + base64.RawURLEncoding.EncodeToString([]byte("forged"))
+	if _, err := auth.jwt.verify(forged, now); err == nil {
+		t.Error("Token with a forged signature was accepted")
+	}
+}
+
+// authRequest sends a request to /auth and returns the recorded response.
+func authRequest(auth *AuthHandler, method string, token string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/auth", strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	auth.HandleAuthFunctions(w, r)
+	return w
+}
+
+// TestRevokeSignedToken checks that a signed token deleted through /auth is rejected,
+// and that its revocation is only kept until the token expires.
+func TestRevokeSignedToken(t *testing.T) {
+	auth := newJWTAuth(t, true)
+	w := authRequest(auth, http.MethodPost, "", `{"username":"alice"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login failed with %d: %s", w.Code, w.Body.String())
+	}
+	token := strings.Split(w.Body.String(), `"`)[3]
+	if !looksLikeJWT(token) {
+		t.Fatalf("Expected a signed token, got %q", token)
+	}
+	if user, ok := auth.Username("Bearer " + token); !ok || user != "alice" {
+		t.Fatalf("Signed token resolved to %q, %v", user, ok)
+	}
+
+	if w := authRequest(auth, http.MethodDelete, token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Logout failed with %d", w.Code)
+	}
+	if auth.CheckToken("Bearer " + token) {
+		t.Error("Revoked token was accepted")
+	}
+	if w := authRequest(auth, http.MethodDelete, token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Second logout answered %d, want 401", w.Code)
+	}
+
+	entry := auth.sessions.entries[hashToken(token)]
+	if entry.Expires.IsZero() || entry.Expires.After(time.Now().Add(tokenLifetime+jwtLeeway)) {
+		t.Errorf("Revocation expires at %v, want when the token does", entry.Expires)
+	}
+	auth.sessions.sweep(entry.Expires)
+	if len(auth.sessions.entries) != 0 {
+		t.Error("Revocation was not swept once the token expired")
+	}
+}
+
+// TestTokenFileTokenWithDots checks that a token from the token file is accepted even if
+// it looks like a signed token.
+func TestTokenFileTokenWithDots(t *testing.T) {
+	auth := newJWTAuth(t, false)
+	auth.sessions.add("service.token.v1", "svc", time.Time{})
+	if user, ok := auth.Username("Bearer service.token.v1"); !ok || user != "svc" {
+		t.Fatalf("Token file token resolved to %q, %v", user, ok)
+	}
+	if w := authRequest(auth, http.MethodDelete, "service.token.v1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Logout failed with %d", w.Code)
+	}
+	if auth.CheckToken("Bearer service.token.v1") {
+		t.Error("Deleted token was accepted")
+	}
+}
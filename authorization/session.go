@@ -0,0 +1,303 @@
+package authorization
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired tokens are removed from the session store.
+const sweepInterval = 1 * time.Minute
+
+// A tokenEntry is what the session store keeps for one token. Tokens themselves are
+// never kept, only their hashes.
+type tokenEntry struct {
+	User    string    `json:"user"`
+	Expires time.Time `json:"expires,omitempty"` // Zero for tokens that do not expire
+}
+
+// expired reports whether the token is no longer valid at the given time.
+func (e tokenEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// A userRecord is what the user registry keeps for one user.
+type userRecord struct {
+	Registered time.Time `json:"registered"` // When the user was first given a token
+}
+
+// A savedStore is the file a persistent session store is saved to.
+type savedStore struct {
+	Users  map[string]userRecord `json:"users"`
+	Tokens map[string]tokenEntry `json:"tokens"` // Keyed by the hash of each token
+}
+
+// hashToken returns the key under which a token is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the token of an Authorization header of the form "Bearer <token>".
+// The second return value is false for any other header.
+func bearerToken(header string) (string, bool) {
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || token == "" || strings.ContainsAny(token, " \t") {
+		return "", false
+	}
+	return token, true
+}
+
+// A sessionStore maps tokens to the users they belong to, and keeps a registry of every
+// user it has issued a token to. Users stay registered after their tokens expire or are
+// removed. It is safe for concurrent use. Expired tokens are rejected as soon as they
+// expire, and removed by a background sweeper.
+type sessionStore struct {
+	mu      sync.Mutex
+	entries map[string]tokenEntry // Hash of each token to its user and expiry
+	users   map[string]userRecord // Registry of users
+	path    string                // File the store is saved to, "" if it is not persistent
+	stop    chan struct{}         // Closed to stop the sweeper
+}
+
+// newSessionStore returns an empty store and starts its sweeper.
+func newSessionStore() *sessionStore {
+	s := &sessionStore{
+		entries: make(map[string]tokenEntry),
+		users:   make(map[string]userRecord),
+		stop:    make(chan struct{}),
+	}
+	go s.sweeper()
+	return s
+}
+
+// lookup returns the user a token belongs to. The second return value is false if the
+// token is unknown or expired.
+func (s *sessionStore) lookup(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[hashToken(token)]
+	if !ok || entry.User == "" || entry.expired(time.Now()) {
+		return "", false
+	}
+	return entry.User, true
+}
+
+// add stores a token for the user, registering the user if they are new. A zero expiry
+// means the token never expires.
+func (s *sessionStore) add(token string, user string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[hashToken(token)] = tokenEntry{User: user, Expires: expires}
+	if _, ok := s.users[user]; !ok {
+		s.users[user] = userRecord{Registered: time.Now()}
+	}
+	s.save()
+}
+
+// registered returns the names of the registered users, in order.
+func (s *sessionStore) registered() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make([]string, 0, len(s.users))
+	for user := range s.users {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// remove deletes a token. It returns false if the token was not in the store.
+func (s *sessionStore) remove(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := hashToken(token)
+	if _, ok := s.entries[hash]; !ok {
+		return false
+	}
+	delete(s.entries, hash)
+	s.save()
+	return true
+}
+
+// revoke records that a signed token was revoked before it expires. The record has no
+// user, so lookup never accepts it, and is swept once the token would have expired.
+func (s *sessionStore) revoke(token string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[hashToken(token)] = tokenEntry{Expires: expires}
+	s.save()
+}
+
+// revoked reports whether a signed token was revoked.
+func (s *sessionStore) revoked(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[hashToken(token)]
+	return ok && entry.User == ""
+}
+
+// sweep removes the tokens that have expired by the given time.
+func (s *sessionStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := false
+	for hash, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, hash)
+			removed = true
+		}
+	}
+	if removed {
+		s.save()
+	}
+}
+
+// sweeper calls sweep every sweepInterval until the store is closed.
+func (s *sessionStore) sweeper() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.sweep(now)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// close stops the sweeper.
+func (s *sessionStore) close() {
+	close(s.stop)
+}
+
+// open makes the store persistent. The users and tokens saved in the file at path by an
+// earlier run are loaded, except the tokens that have expired, and every later change is
+// saved there. The file does not have to exist yet.
+func (s *sessionStore) open(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dat, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var saved savedStore
+		if err := json.Unmarshal(dat, &saved); err != nil {
+			return err
+		}
+		now := time.Now()
+		for hash, entry := range saved.Tokens {
+			if !entry.expired(now) {
+				s.entries[hash] = entry
+			}
+		}
+		for user, record := range saved.Users {
+			if _, ok := s.users[user]; !ok {
+				s.users[user] = record
+			}
+		}
+	}
+	s.path = path
+	return s.persist()
+}
+
+// save persists the store, logging any failure; a session that could not be saved is
+// still valid until the server stops. The caller must hold s.mu.
+func (s *sessionStore) save() {
+	if err := s.persist(); err != nil {
+		slog.Error("Unable to save token store", "error", err)
+	}
+}
+
+// persist saves the store, if it is persistent. The file is replaced atomically so that a
+// crash never leaves it half written. The caller must hold s.mu.
+func (s *sessionStore) persist() error {
+	if s.path == "" {
+		return nil
+	}
+	dat, err := json.Marshal(savedStore{Users: s.users, Tokens: s.entries})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(dat); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// A fileToken is a user's entry in a token file: either the token alone, which does not
+// expire, or an object holding the token and the time it expires, in RFC 3339 format.
+type fileToken struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+func (f *fileToken) UnmarshalJSON(dat []byte) error {
+	if err := json.Unmarshal(dat, &f.Token); err == nil {
+		return nil
+	}
+	type plain fileToken
+	return json.Unmarshal(dat, (*plain)(f))
+}
+
+// LoadTokenFile registers the users of a token file, a JSON object mapping each user to
+// their token, and adds the tokens to the session store. A token is given either as a
+// string, and never expires, or as {"token": ..., "expires": ...}.
+func (auth *AuthHandler) LoadTokenFile(path string) error {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var tokens map[string]fileToken
+	if err := json.Unmarshal(dat, &tokens); err != nil {
+		return err
+	}
+	for user, token := range tokens {
+		if token.Token == "" {
+			return fmt.Errorf("token file %s has no token for %q", path, user)
+		}
+	}
+	for user, token := range tokens {
+		auth.sessions.add(token.Token, user, token.Expires)
+	}
+	return nil
+}
+
+// Users returns the names of every user that has been issued a token, in order, whether
+// or not any of their tokens is still valid.
+func (auth *AuthHandler) Users() []string {
+	return auth.sessions.registered()
+}
+
+// OpenStore makes the session store persistent, saving it to the file at path and
+// loading the tokens saved there by an earlier run.
+func (auth *AuthHandler) OpenStore(path string) error {
+	return auth.sessions.open(path)
+}
+
+// Close stops the session store's background sweeper.
+func (auth *AuthHandler) Close() {
+	auth.sessions.close()
+}
@@ -0,0 +1,238 @@
+package authorization
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain silences the request logging of the handlers under test.
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newTestAuth returns an AuthHandler that is closed when the test ends.
+func newTestAuth(t *testing.T) *AuthHandler {
+	t.Helper()
+	auth := NewAuth()
+	t.Cleanup(auth.Close)
+	return auth
+}
+
+func TestLoadTokenFile(t *testing.T) {
+	auth := newTestAuth(t)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, []byte(`{"alice":"secret-a","bob":"secret-b"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.LoadTokenFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, ok := auth.Username("Bearer secret-b"); !ok || user != "bob" {
+		t.Errorf("Token of bob resolved to %q, %v", user, ok)
+	}
+	if _, ok := auth.Username("Bearer secret-c"); ok {
+		t.Error("Unknown token was accepted")
+	}
+}
+
+// TestTokenFileExpiry checks that tokens given with an expiry in the token file are
+// rejected once they expire, while their users stay registered.
+func TestTokenFileExpiry(t *testing.T) {
+	auth := newTestAuth(t)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	tokens := `{
+		"alice": {"token": "secret-a", "expires": "2000-01-01T00:00:00Z"},
+		"bob": {"token": "secret-b", "expires": "2999-01-01T00:00:00Z"},
+		"root": "secret-r"
+	}`
+	if err := os.WriteFile(path, []byte(tokens), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.LoadTokenFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := auth.Username("Bearer secret-a"); ok {
+		t.Error("Expired token from the token file was accepted")
+	}
+	if user, ok := auth.Username("Bearer secret-b"); !ok || user != "bob" {
+		t.Errorf("Unexpired token resolved to %q, %v", user, ok)
+	}
+	if user, ok := auth.Username("Bearer secret-r"); !ok || user != "root" {
+		t.Errorf("Token without an expiry resolved to %q, %v", user, ok)
+	}
+	if users := strings.Join(auth.Users(), ","); users != "alice,bob,root" {
+		t.Errorf("Registered users are %s, want alice,bob,root", users)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"alice": {"expires": "2999-01-01T00:00:00Z"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.LoadTokenFile(path); err == nil {
+		t.Error("Token file entry without a token was accepted")
+	}
+}
+
+// TestStoreSurvivesRestart checks that sessions are saved, as hashes, and loaded again by
+// a new handler opening the same file.
+func TestStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	auth := newTestAuth(t)
+	if err := auth.OpenStore(path); err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.makeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.sessions.add(token, "alice", time.Now().Add(time.Hour))
+
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dat), token) {
+		t.Error("Store file holds the token in plaintext")
+	}
+
+	restarted := newTestAuth(t)
+	if err := restarted.OpenStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if user, ok := restarted.Username("Bearer " + token); !ok || user != "alice" {
+		t.Errorf("Token resolved to %q, %v after a restart", user, ok)
+	}
+
+	// Users stay registered once their tokens are gone, across restarts too.
+	restarted.sessions.remove(token)
+	again := newTestAuth(t)
+	if err := again.OpenStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if users := again.Users(); len(users) != 1 || users[0] != "alice" {
+		t.Errorf("Registered users after a restart are %v, want alice", users)
+	}
+}
+
+func TestMakeToken(t *testing.T) {
+	auth := newTestAuth(t)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := auth.makeToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) != tokenLen || strings.Trim(token, charset) != "" {
+			t.Fatalf("Token %q is not %d characters of the charset", token, tokenLen)
+		}
+		if seen[token] {
+			t.Fatalf("Token %q was made twice", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer abc", "abc", true},
+		{"Bearer a.b.c", "a.b.c", true},
+		{"", "", false},
+		{"abc", "", false},
+		{"bearer abc", "", false},
+		{"Bearer ", "", false},
+		{"Bearer  abc", "", false},
+		{"Bearer abc def", "", false},
+		{"Bearer abc\tdef", "", false},
+		{"Basic abc", "", false},
+	}
+	for _, test := range tests {
+		token, ok := bearerToken(test.header)
+		if token != test.token || ok != test.ok {
+			t.Errorf("bearerToken(%q) = %q, %v, want %q, %v", test.header, token, ok, test.token, test.ok)
+		}
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	s := newSessionStore()
+	defer s.close()
+	now := time.Now()
+	s.add("expired", "alice", now.Add(-time.Second))
+	s.add("valid", "bob", now.Add(time.Hour))
+	s.add("forever", "root", time.Time{})
+
+	if _, ok := s.lookup("expired"); ok {
+		t.Error("Expired token was accepted before being swept")
+	}
+	if user, ok := s.lookup("valid"); !ok || user != "bob" {
+		t.Errorf("Valid token resolved to %q, %v", user, ok)
+	}
+
+	s.sweep(now)
+	if _, ok := s.entries[hashToken("expired")]; ok {
+		t.Error("Expired token was not swept")
+	}
+	s.sweep(now.Add(2 * time.Hour))
+	if len(s.entries) != 1 {
+		t.Errorf("Expected only the token without an expiry to remain, got %v", s.entries)
+	}
+	if user, ok := s.lookup("forever"); !ok || user != "root" {
+		t.Errorf("Token without an expiry resolved to %q, %v", user, ok)
+	}
+}
+
+// TestExpiredTokensAreNotReloaded checks that a persisted store drops the tokens that
+// expired while the server was stopped.
+func TestExpiredTokensAreNotReloaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s := newSessionStore()
+	defer s.close()
+	if err := s.open(path); err != nil {
+		t.Fatal(err)
+	}
+	s.add("short", "alice", time.Now().Add(10*time.Millisecond))
+	s.add("long", "bob", time.Now().Add(time.Hour))
+	time.Sleep(20 * time.Millisecond)
+
+	reopened := newSessionStore()
+	defer reopened.close()
+	if err := reopened.open(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.entries) != 1 {
+		t.Errorf("Reopened store holds %d tokens, want only the unexpired one", len(reopened.entries))
+	}
+}
+
+func TestLogout(t *testing.T) {
+	auth := newTestAuth(t)
+	w := authRequest(auth, http.MethodPost, "", `{"username":"alice"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login failed with %d: %s", w.Code, w.Body.String())
+	}
+	token := strings.Split(w.Body.String(), `"`)[3]
+	if user, ok := auth.Username("Bearer " + token); !ok || user != "alice" {
+		t.Fatalf("New token resolved to %q, %v", user, ok)
+	}
+	if w := authRequest(auth, http.MethodDelete, token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Logout answered %d", w.Code)
+	}
+	if auth.CheckToken("Bearer " + token) {
+		t.Error("Token was accepted after logout")
+	}
+	if w := authRequest(auth, http.MethodDelete, token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Second logout answered %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,311 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A role grants a user access to everything under a path prefix. Each role includes the
+// ones before it.
+type role int
+
+const (
+	noRole role = iota
+	roleReader
+	roleWriter
+	roleAdmin
+)
+
+// roleNames are the names roles have in the _acl API.
+var roleNames = map[role]string{roleReader: "reader", roleWriter: "writer", roleAdmin: "admin"}
+
+func (r role) String() string { return roleNames[r] }
+
+// parseRole reads the name of a role.
+func parseRole(name string) (role, error) {
+	for r, roleName := range roleNames {
+		if roleName == name {
+			return r, nil
+		}
+	}
+	return noRole, fmt.Errorf("unknown role %q", name)
+}
+
+// A grant is one entry of the access control list, as sent and returned by the _acl API.
+type grant struct {
+	User string `json:"user"`
+	Path string `json:"path"`
+	Role string `json:"role"`
+}
+
+// An accessControl holds the roles granted to users on path prefixes such as /v1/prod or
+// /v1/prod/orders. A role granted on a path also applies to everything beneath it, and a
+// user's role on a path is the highest role granted on the path or any of its ancestors.
+// Global admins are admins of every path, and the creator of a database is an admin of
+// it. Roles are only required of every request once access control is enforced, but
+// deleting a database always needs an admin, and admin rights also let users override
+// document ownership. Grants are kept in memory, like the databases, and are lost when
+// the server stops. It is safe for concurrent use.
+type accessControl struct {
+	mu       sync.Mutex
+	enforced bool
+	admins   map[string]bool
+	grants   map[string]map[string]role // User to the roles granted on each path
+}
+
+// newAccessControl returns an access control list without grants, which is not enforced.
+func newAccessControl() *accessControl {
+	return &accessControl{admins: make(map[string]bool), grants: make(map[string]map[string]role)}
+}
+
+// SetAdmins makes the given users admins of every path.
+func (ds *DatabaseService) SetAdmins(admins []string) {
+	ds.acl.mu.Lock()
+	defer ds.acl.mu.Unlock()
+	for _, admin := range admins {
+		ds.acl.admins[admin] = true
+	}
+}
+
+// EnableAccessControl makes every request need a role on the path it addresses. Users
+// other than the global admins need a role granted through the _acl API.
+func (ds *DatabaseService) EnableAccessControl() {
+	ds.acl.mu.Lock()
+	defer ds.acl.mu.Unlock()
+	ds.acl.enforced = true
+}
+
+// normalizeACLPath turns a path into the form grants are kept in, without a trailing slash
+// or action segment. The path /v1 covers every database.
+func normalizeACLPath(path string) (string, error) {
+	base, _ := splitAction(path)
+	if strings.Trim(base, "/") == "v1" {
+		return "/v1", nil
+	}
+	pathParts, err := splitPath(base)
+	if err != nil {
+		return "", err
+	}
+	if pathParts[0] != "v1" {
+		return "", fmt.Errorf("invalid path %q", path)
+	}
+	return pathKey(pathParts), nil
+}
+
+// covers reports whether a grant on prefix applies to path.
+func covers(prefix string, path string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// roleOn returns the user's role on a normalized path.
+func (acl *accessControl) roleOn(user string, path string) role {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	if acl.admins[user] {
+		return roleAdmin
+	}
+	best := noRole
+	for prefix, r := range acl.grants[user] {
+		if r > best && covers(prefix, path) {
+			best = r
+		}
+	}
+	return best
+}
+
+// dropGrants revokes every grant on the normalized path or beneath it, so that a deleted
+// database's roles do not carry over to a new database of the same name.
+func (acl *accessControl) dropGrants(path string) {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	for _, roles := range acl.grants {
+		for prefix := range roles {
+			if covers(path, prefix) {
+				delete(roles, prefix)
+			}
+		}
+	}
+}
+
+// allowed reports whether the user holds at least the wanted role on the path. Every
+// request is allowed when access control is not enforced.
+func (ds *DatabaseService) allowed(user string, path string, want role) bool {
+	ds.acl.mu.Lock()
+	enforced := ds.acl.enforced
+	ds.acl.mu.Unlock()
+	if !enforced {
+		return true
+	}
+	return ds.hasRole(user, path, want)
+}
+
+// IsAdmin reports whether the user is an admin of the path, whether or not access control
+// is enforced. Admins are the users given to SetAdmins, the creator of the path's
+// database, and those granted the admin role on the path, or a prefix of it, through the
+// _acl API.
+func (ds *DatabaseService) IsAdmin(user string, path string) bool {
+	return ds.hasRole(user, path, roleAdmin)
+}
+
+// hasRole reports whether the user holds at least the wanted role on the path.
+func (ds *DatabaseService) hasRole(user string, path string, want role) bool {
+	normalized, err := normalizeACLPath(path)
+	if err != nil {
+		return false
+	}
+	if ds.createdDatabase(user, normalized) {
+		return true
+	}
+	return ds.acl.roleOn(user, normalized) >= want
+}
+
+// createdDatabase reports whether the user created the database of a normalized path.
+func (ds *DatabaseService) createdDatabase(user string, path string) bool {
+	pathParts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(pathParts) < 2 {
+		return false
+	}
+	database, exists := ds.collections.Find(pathParts[1])
+	return exists && database.metadata().CreatedBy == user
+}
+
+// requiredRole returns the role a request needs on its path. Reads need a reader and
+// writes a writer, while creating or deleting a whole database needs an admin.
+// Transactions and bulk writes need no role on the database, since each of their
+// operations is checked against the document it writes. A copy only reads its source;
+// its destination is checked when the copy is made.
+func requiredRole(r *http.Request) role {
+	path, action := splitAction(r.URL.Path)
+	switch {
+	case action == "_transaction" || action == "_bulk":
+		return noRole
+	case r.Method == http.MethodGet || action == "_copy":
+		return roleReader
+	case action == "" && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+		if pathParts, err := splitPath(path); err == nil && len(pathParts) == 2 {
+			return roleAdmin
+		}
+	}
+	return roleWriter
+}
+
+// deletesDatabase reports whether the request deletes a whole database.
+func deletesDatabase(r *http.Request) bool {
+	if r.Method != http.MethodDelete {
+		return false
+	}
+	path, action := splitAction(r.URL.Path)
+	pathParts, err := splitPath(path)
+	return action == "" && err == nil && len(pathParts) == 2
+}
+
+// sendForbidden answers a request the user has no role for.
+func sendForbidden(w http.ResponseWriter) {
+	sendErrorResponse(w, http.StatusForbidden, "\"Access denied\"")
+}
+
+// HandleACL answers requests on /_acl, which manages the roles of users. GET lists the
+// grants on paths the caller is an admin of, PUT grants a role given as
+// {"user": ..., "path": ..., "role": ...} and DELETE, with user and path parameters,
+// revokes a grant. Only admins of a path may change the roles granted on it. Grants
+// are not saved, so they have to be made again after the server restarts.
+func (ds *DatabaseService) HandleACL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	caller, ok := ds.auth.Username(r.Header.Get("Authorization"))
+	if !ok {
+		w.Header().Add("WWW-Authenticate", "Bearer")
+		sendErrorResponse(w, http.StatusUnauthorized, "\"Missing or invalid bearer token\"")
+		return
+	}
+	acl := ds.acl
+
+	switch r.Method {
+	case http.MethodGet:
+		grants := []grant{}
+		acl.mu.Lock()
+		for user, roles := range acl.grants {
+			for path, granted := range roles {
+				grants = append(grants, grant{User: user, Path: path, Role: granted.String()})
+			}
+		}
+		acl.mu.Unlock()
+		visible := grants[:0]
+		for _, g := range grants {
+			if ds.IsAdmin(caller, g.Path) {
+				visible = append(visible, g)
+			}
+		}
+		sort.Slice(visible, func(i, j int) bool {
+			if visible[i].Path != visible[j].Path {
+				return visible[i].Path < visible[j].Path
+			}
+			return visible[i].User < visible[j].User
+		})
+		response, err := json.Marshal(visible)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+
+	case http.MethodPut:
+		var g grant
+		if err := json.NewDecoder(r.Body).Decode(&g); err != nil || g.User == "" || g.Path == "" {
+			sendErrorResponse(w, http.StatusBadRequest, "\"A grant needs a user, path and role\"")
+			return
+		}
+		granted, err := parseRole(g.Role)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		path, err := normalizeACLPath(g.Path)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		if !ds.IsAdmin(caller, path) {
+			sendForbidden(w)
+			return
+		}
+		acl.mu.Lock()
+		if acl.grants[g.User] == nil {
+			acl.grants[g.User] = make(map[string]role)
+		}
+		acl.grants[g.User][path] = granted
+		acl.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		user, path := r.URL.Query().Get("user"), r.URL.Query().Get("path")
+		path, err := normalizeACLPath(path)
+		if err != nil || user == "" || path == "" {
+			sendErrorResponse(w, http.StatusBadRequest, "\"Revoking a grant needs a user and path\"")
+			return
+		}
+		if !ds.IsAdmin(caller, path) {
+			sendForbidden(w)
+			return
+		}
+		acl.mu.Lock()
+		_, exists := acl.grants[user][path]
+		delete(acl.grants[user], path)
+		acl.mu.Unlock()
+		if !exists {
+			sendErrorResponse(w, http.StatusNotFound, "\"Grant does not exist\"")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "\"Method not allowed\"")
+	}
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// aclDo sends a request from the user to the _acl API and returns the recorded response.
+func aclDo(ds *DatabaseService, user string, method string, target string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ds.HandleACL(w, newRequest(user, method, target, body))
+	return w
+}
+
+// newACLService returns an access controlled service whose admin is root, with the
+// documents d and dd in the database db.
+func newACLService(t *testing.T) *DatabaseService {
+	t.Helper()
+	ds := newTestService(t)
+	ds.SetAdmins([]string{"root"})
+	ds.EnableAccessControl()
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/dd", `{}`, http.StatusCreated)
+	return ds
+}
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         role
+	}{
+		{http.MethodGet, "/v1/db/d", roleReader},
+		{http.MethodGet, "/v1/db", roleReader},
+		{http.MethodPut, "/v1/db/d", roleWriter},
+		{http.MethodPatch, "/v1/db/d", roleWriter},
+		{http.MethodDelete, "/v1/db/d/c/", roleWriter},
+		{http.MethodPut, "/v1/db", roleAdmin},
+		{http.MethodDelete, "/v1/db", roleAdmin},
+		{http.MethodPost, "/v1/db/_transaction", noRole},
+		{http.MethodPost, "/v1/db/_bulk", noRole},
+		{http.MethodPut, "/v1/db/_policy", roleWriter},
+		{http.MethodPost, "/v1/db/d/_copy", roleReader},
+		{http.MethodPost, "/v1/db/d/_move", roleWriter},
+	}
+	for _, test := range tests {
+		if got := requiredRole(httptest.NewRequest(test.method, test.path, nil)); got != test.want {
+			t.Errorf("%s %s needs %v, want %v", test.method, test.path, got, test.want)
+		}
+	}
+}
+
+// TestRolesApplyBeneathTheirPath checks that a role granted on a path applies to
+// everything beneath it, but not to siblings sharing a prefix of its name.
+func TestRolesApplyBeneathTheirPath(t *testing.T) {
+	ds := newACLService(t)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d", "", http.StatusForbidden)
+
+	grantRole(t, ds, "alice", "/v1/db", "reader")
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d", "", http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusForbidden)
+
+	grantRole(t, ds, "alice", "/v1/db/d", "writer")
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/x", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/dd", `{}`, http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db", "", http.StatusForbidden)
+
+	// Revoking the grant leaves the reader role on the database.
+	if w := aclDo(ds, "root", http.MethodDelete, "/_acl?user=alice&path=/v1/db/d", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Revoking failed with %d", w.Code)
+	}
+	if w := aclDo(ds, "root", http.MethodDelete, "/_acl?user=alice&path=/v1/db/d", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Revoking a missing grant answered %d, want 404", w.Code)
+	}
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d/c/x", "", http.StatusOK)
+}
+
+// TestDelegatedAdmins checks that admins of a path manage the roles beneath it, and see
+// only those grants.
+func TestDelegatedAdmins(t *testing.T) {
+	ds := newACLService(t)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/other", "", http.StatusCreated)
+	grantRole(t, ds, "bob", "/v1/db", "admin")
+	grantRole(t, ds, "alice", "/v1/other", "reader")
+
+	if w := aclDo(ds, "bob", http.MethodPut, "/_acl", `{"user":"alice","path":"/v1/db/d","role":"writer"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("Delegated grant failed with %d: %s", w.Code, w.Body.String())
+	}
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusOK)
+	for _, body := range []string{
+		`{"user":"alice","path":"/v1/other","role":"writer"}`,
+		`{"user":"alice","path":"/v1","role":"reader"}`,
+	} {
+		if w := aclDo(ds, "bob", http.MethodPut, "/_acl", body); w.Code != http.StatusForbidden {
+			t.Errorf("Grant %s outside bob's path answered %d, want 403", body, w.Code)
+		}
+	}
+	if w := aclDo(ds, "bob", http.MethodPut, "/_acl", `{"user":"alice","path":"/v1/db","role":"owner"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Grant of an unknown role answered %d, want 400", w.Code)
+	}
+
+	var grants []grant
+	decode(t, aclDo(ds, "bob", http.MethodGet, "/_acl", ""), &grants)
+	want := []grant{{User: "bob", Path: "/v1/db", Role: "admin"}, {User: "alice", Path: "/v1/db/d", Role: "writer"}}
+	if len(grants) != len(want) || grants[0] != want[0] || grants[1] != want[1] {
+		t.Errorf("Bob sees grants %v, want %v", grants, want)
+	}
+
+	// Admins of a database may delete it, but no other database.
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/db", "", http.StatusNoContent)
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/other", "", http.StatusForbidden)
+}
+
+// TestCopyNeedsReaderOnSource checks that copies only need to read their source, while
+// moves need to write it, and both need to write their destination.
+func TestCopyNeedsReaderOnSource(t *testing.T) {
+	ds := newACLService(t)
+	grantRole(t, ds, "alice", "/v1/db", "reader")
+	grantRole(t, ds, "alice", "/v1/db/copy", "writer")
+
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/d/_copy", `{"destination":"/v1/db/copy"}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/d/_copy", `{"destination":"/v1/db/other"}`, http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/d/_move", `{"destination":"/v1/db/copy","overwrite":true}`, http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d", "", http.StatusOK)
+}
+
+// TestDatabaseDeleteWithoutAccessControl checks that deleting a database needs an admin
+// of it, such as its creator, even when roles are not enforced.
+func TestDatabaseDeleteWithoutAccessControl(t *testing.T) {
+	ds := newTestService(t)
+	ds.SetAdmins([]string{"root"})
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/a", "", http.StatusCreated)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/b", "", http.StatusCreated)
+
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/a", "", http.StatusForbidden)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/a/d", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/a", "", http.StatusNoContent)
+	mustDo(t, ds, "root", http.MethodDelete, "/v1/b", "", http.StatusNoContent)
+
+	// The creator of a database may delegate its administration.
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/c", "", http.StatusCreated)
+	if w := aclDo(ds, "alice", http.MethodPut, "/_acl", `{"user":"bob","path":"/v1/c","role":"admin"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("Creator's grant failed with %d: %s", w.Code, w.Body.String())
+	}
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/c", "", http.StatusNoContent)
+
+	// Grants on a deleted database do not apply to a new one of the same name.
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/c", "", http.StatusCreated)
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/c", "", http.StatusForbidden)
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonvisit"
+)
+
+// Aggregation operators supported by the _aggregate endpoint.
+var aggregateOps = map[string]bool{
+	"count":    true,
+	"sum":      true,
+	"min":      true,
+	"max":      true,
+	"avg":      true,
+	"distinct": true,
+}
+
+// An aggregation computes one operator over the value at a JSON Pointer of every
+// document selected by a query, optionally grouped by the value at another pointer.
+type aggregation struct {
+	op      string
+	field   []string
+	groupBy []string
+	grouped bool
+}
+
+// An aggregateGroup accumulates the documents that share a group-by value.
+type aggregateGroup struct {
+	key      any
+	count    int
+	sum      float64
+	extreme  any
+	distinct map[string]any
+	order    []string // Encoded distinct values in order of first appearance
+}
+
+// An aggregateResult is the JSON form of one group's result.
+type aggregateResult struct {
+	Key   any `json:"key"`
+	Count int `json:"count"`
+	Value any `json:"value"`
+}
+
+// parseAggregation reads the op, field and groupby parameters of an _aggregate request.
+func parseAggregation(values url.Values) (*aggregation, error) {
+	a := &aggregation{op: values.Get("op")}
+	if a.op == "" {
+		a.op = "count"
+	}
+	if !aggregateOps[a.op] {
+		return nil, fmt.Errorf("unknown aggregation %q", a.op)
+	}
+
+	field := values.Get("field")
+	if field == "" && a.op != "count" {
+		return nil, fmt.Errorf("aggregation %q requires a field", a.op)
+	}
+	var err error
+	if a.field, err = parsePointer(field); err != nil {
+		return nil, err
+	}
+
+	if groupBy, ok := values["groupby"]; ok {
+		a.grouped = true
+		if a.groupBy, err = parsePointer(groupBy[0]); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// add folds one document into its group.
+func (a *aggregation) add(group *aggregateGroup, data any) {
+	if a.op == "count" {
+		group.count++
+		return
+	}
+
+	value, err := resolvePointer(data, a.field)
+	if err != nil {
+		// Documents without the field do not contribute.
+		return
+	}
+
+	switch a.op {
+	case "sum", "avg":
+		s, _ := jsonvisit.Accept[scalar](value, scalarVisitor{})
+		if s.kind != "number" {
+			return
+		}
+		group.sum += s.num
+	case "min", "max":
+		if group.count == 0 {
+			// Only numbers and strings can be ordered.
+			if _, ok := compareJSON(value, value); !ok {
+				return
+			}
+			group.extreme = value
+			break
+		}
+		order, ok := compareJSON(value, group.extreme)
+		if !ok {
+			// Values that cannot be ordered against the current extreme are skipped.
+			return
+		}
+		if (a.op == "min" && order < 0) || (a.op == "max" && order > 0) {
+			group.extreme = value
+		}
+	case "distinct":
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		if _, seen := group.distinct[string(encoded)]; !seen {
+			group.distinct[string(encoded)] = value
+			group.order = append(group.order, string(encoded))
+		}
+	}
+	group.count++
+}
+
+// result returns the final value of a group.
+func (a *aggregation) result(group *aggregateGroup) aggregateResult {
+	result := aggregateResult{Key: group.key, Count: group.count}
+	switch a.op {
+	case "count":
+		result.Value = group.count
+	case "sum":
+		result.Value = group.sum
+	case "avg":
+		if group.count > 0 {
+			result.Value = group.sum / float64(group.count)
+		}
+	case "min", "max":
+		result.Value = group.extreme
+	case "distinct":
+		values := make([]any, 0, len(group.order))
+		for _, encoded := range group.order {
+			values = append(values, group.distinct[encoded])
+		}
+		result.Value = values
+	}
+	return result
+}
+
+// HandleAggregate answers GET requests on the _aggregate action of a collection.
+// Documents are streamed through the skip list and folded into their group as they are
+// visited, so only the running totals are held in memory.
+func (ds *DatabaseService) HandleAggregate(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	pathParts, err := splitPath(path)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+	if len(pathParts)%2 != 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Aggregation requires a collection\"")
+		return
+	}
+
+	query, err := parseCollectionQuery(r.URL.Query())
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+	agg, err := parseAggregation(r.URL.Query())
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+
+	// Lock the database.
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	item, exists := ds.findItem(pathParts)
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Collection does not exist\"")
+		return
+	}
+
+	groups := make(map[string]*aggregateGroup)
+	var order []string
+	err = query.run(r.Context(), item.(*Collection), func(doc *Document) bool {
+		var key any
+		if agg.grouped {
+			// Documents without the group-by value fall into the null group.
+			key, _ = resolvePointer(doc.Data, agg.groupBy)
+		}
+		encoded, err := json.Marshal(key)
+		if err != nil {
+			return true
+		}
+		group, ok := groups[string(encoded)]
+		if !ok {
+			group = &aggregateGroup{key: key, distinct: make(map[string]any)}
+			groups[string(encoded)] = group
+			order = append(order, string(encoded))
+		}
+		agg.add(group, doc.Data)
+		return true
+	})
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+
+	var body any
+	if agg.grouped {
+		results := make([]aggregateResult, 0, len(order))
+		for _, encoded := range order {
+			results = append(results, agg.result(groups[encoded]))
+		}
+		body = map[string]any{"op": agg.op, "groups": results}
+	} else {
+		group, ok := groups["null"]
+		if !ok {
+			group = &aggregateGroup{distinct: make(map[string]any)}
+		}
+		result := agg.result(group)
+		body = map[string]any{"op": agg.op, "count": result.Count, "value": result.Value}
+	}
+
+	response, err := json.Marshal(body)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// newScoresService returns a service whose database db holds scores of two teams, one
+// score that is not a number and one document without a team.
+func newScoresService(t *testing.T) *DatabaseService {
+	t.Helper()
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	docs := map[string]string{
+		"a": `{"team":"red","score":3}`,
+		"b": `{"team":"blue","score":5}`,
+		"c": `{"team":"red","score":4}`,
+		"d": `{"team":"red","score":"n/a"}`,
+		"e": `{"score":1}`,
+	}
+	for name, body := range docs {
+		mustDo(t, ds, "alice", http.MethodPut, "/v1/db/"+name, body, http.StatusCreated)
+	}
+	return ds
+}
+
+// aggregate runs an aggregation on the database with the given parameters.
+func aggregate(t *testing.T, ds *DatabaseService, params url.Values) map[string]any {
+	t.Helper()
+	var body map[string]any
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/_aggregate?"+params.Encode(), "", http.StatusOK), &body)
+	return body
+}
+
+func TestAggregate(t *testing.T) {
+	ds := newScoresService(t)
+	tests := []struct {
+		params url.Values
+		count  float64
+		value  any
+	}{
+		{url.Values{}, 5, 5.0},
+		{url.Values{"op": {"sum"}, "field": {"/score"}}, 4, 13.0},
+		{url.Values{"op": {"avg"}, "field": {"/score"}}, 4, 3.25},
+		{url.Values{"op": {"min"}, "field": {"/score"}}, 4, 1.0},
+		{url.Values{"op": {"max"}, "field": {"/score"}}, 4, 5.0},
+		{url.Values{"op": {"distinct"}, "field": {"/team"}}, 4, []any{"red", "blue"}},
+		{url.Values{"where": {"/score>3"}}, 2, 2.0},
+		{url.Values{"interval": {"[b,d]"}, "op": {"sum"}, "field": {"/score"}}, 2, 9.0},
+	}
+	for _, test := range tests {
+		body := aggregate(t, ds, test.params)
+		if body["count"] != test.count || !reflect.DeepEqual(body["value"], test.value) {
+			t.Errorf("Aggregation %v returned %v, want count %v and value %v", test.params, body, test.count, test.value)
+		}
+	}
+}
+
+func TestAggregateGroupBy(t *testing.T) {
+	ds := newScoresService(t)
+	body := aggregate(t, ds, url.Values{"op": {"sum"}, "field": {"/score"}, "groupby": {"/team"}})
+	want := []any{
+		map[string]any{"key": "red", "count": 2.0, "value": 7.0},
+		map[string]any{"key": "blue", "count": 1.0, "value": 5.0},
+		map[string]any{"key": nil, "count": 1.0, "value": 1.0},
+	}
+	if !reflect.DeepEqual(body["groups"], want) {
+		t.Errorf("Groups are %v, want %v", body["groups"], want)
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	ds := newScoresService(t)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/_aggregate?op=median&field=/score", "", http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/_aggregate?op=sum", "", http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/a/_aggregate", "", http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/a/missing/_aggregate", "", http.StatusNotFound)
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"unicode"
+)
+
+// A bulkResult is the outcome of one operation of a bulk write.
+type bulkResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	URI    string `json:"uri,omitempty"`
+	Status int    `json:"status"`
+	ETag   string `json:"etag,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// A bulkReader decodes the operations of a bulk request one at a time, from either a JSON
+// array or a stream of newline delimited JSON values.
+type bulkReader struct {
+	decoder *json.Decoder
+	array   bool
+}
+
+// newBulkReader starts reading a bulk request body. The body is an array if its first
+// non-space character is "[", and NDJSON otherwise.
+func newBulkReader(body io.Reader) (*bulkReader, error) {
+	buffered := bufio.NewReader(body)
+	for {
+		c, _, err := buffered.ReadRune()
+		if err == io.EOF {
+			return &bulkReader{decoder: json.NewDecoder(buffered)}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !unicode.IsSpace(c) {
+			buffered.UnreadRune()
+			break
+		}
+	}
+
+	reader := &bulkReader{decoder: json.NewDecoder(buffered)}
+	if c, _ := buffered.Peek(1); len(c) == 1 && c[0] == '[' {
+		reader.array = true
+		if _, err := reader.decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+// next decodes the next operation. It returns io.EOF after the last one.
+func (reader *bulkReader) next(op *txOperation) error {
+	if reader.array && !reader.decoder.More() {
+		if _, err := reader.decoder.Token(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	return reader.decoder.Decode(op)
+}
+
+// HandleBulk answers POST /v1/{db}/_bulk. The body holds put, patch and delete operations
+// in the form a transaction takes, but each is applied on its own and reported with its own
+// status. Operations are decoded, applied and answered one at a time, in the format of the
+// request, so memory use does not grow with the size of the request. The database lock is
+// only held for each operation, so other clients are not blocked for the whole request.
+func (ds *DatabaseService) HandleBulk(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	pathParts, err := splitPath(path)
+	if err != nil || len(pathParts) != 2 {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Bulk writes are only supported on a database\"")
+		return
+	}
+	ds.mu.Lock()
+	_, exists := ds.collections.Find(pathParts[1])
+	ds.mu.Unlock()
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Database does not exist\"")
+		return
+	}
+
+	reader, err := newBulkReader(r.Body)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+		return
+	}
+	user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+
+	flusher, canFlush := w.(http.Flusher)
+	if reader.array {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	if reader.array {
+		w.Write([]byte("["))
+	}
+
+	for index := 0; r.Context().Err() == nil; index++ {
+		var op txOperation
+		err := reader.next(&op)
+		if err == io.EOF {
+			break
+		}
+
+		result := bulkResult{Index: index, Op: op.Op}
+		if err != nil {
+			// The rest of the body cannot be read, so this is the last result.
+			result.Status = http.StatusBadRequest
+			result.Error = "Failed to decode operation: " + err.Error()
+		} else {
+			result = ds.applyBulkOperation(pathParts[1], user, op)
+			result.Index = index
+		}
+
+		if reader.array && index > 0 {
+			w.Write([]byte(","))
+		}
+		// Encode ends each result with a newline, which also separates NDJSON records.
+		if writeErr := encoder.Encode(result); writeErr != nil {
+			slog.Info("Bulk response stopped", "path", r.URL.Path, "error", writeErr)
+			return
+		}
+		if canFlush && (index+1)%streamFlushInterval == 0 {
+			flusher.Flush()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if reader.array {
+		w.Write([]byte("]"))
+	}
+	if canFlush {
+		flusher.Flush()
+	}
+}
+
+// applyBulkOperation applies a single operation of a bulk write as a transaction of its own.
+func (ds *DatabaseService) applyBulkOperation(database string, user string, op txOperation) bulkResult {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tx := &transaction{ds: ds, database: database, user: user, staged: make(map[string]*stagedWrite)}
+	staged, status, err := tx.stage(0, op)
+	if err != nil {
+		return bulkResult{Op: op.Op, Status: status, Error: err.Error()}
+	}
+	if _, err := tx.runTriggers(); err != nil {
+		return bulkResult{Op: op.Op, Status: http.StatusBadRequest, Error: err.Error()}
+	}
+	tx.commit()
+	result := bulkResult{Op: op.Op, URI: staged.URI, Status: http.StatusOK}
+	if staged.created {
+		result.Status = http.StatusCreated
+	}
+	if staged.doc != nil {
+		result.ETag = staged.doc.ETag()
+	}
+	return result
+}
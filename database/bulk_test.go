@@ -0,0 +1,105 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// bulkResults sends a bulk request in NDJSON and returns its per-operation results.
+func bulkResults(t *testing.T, ds *DatabaseService, user string, path string, body string) []bulkResult {
+	t.Helper()
+	w := mustDo(t, ds, user, http.MethodPost, path, body, http.StatusOK)
+	var results []bulkResult
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var result bulkResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid result %q: %v", scanner.Text(), err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// grantRole gives the user a role on the path, on behalf of the admin root.
+func grantRole(t *testing.T, ds *DatabaseService, user string, path string, role string) {
+	t.Helper()
+	body, _ := json.Marshal(grant{User: user, Path: path, Role: role})
+	r := newRequest("root", http.MethodPut, "/_acl", string(body))
+	w := httptest.NewRecorder()
+	ds.HandleACL(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Granting %s %s on %s failed with %d: %s", user, role, path, w.Code, w.Body.String())
+	}
+}
+
+func TestBulkReportsEachOperation(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/old", `{}`, http.StatusCreated)
+
+	results := bulkResults(t, ds, "alice", "/v1/db/_bulk", strings.Join([]string{
+		`{"op":"put","path":"/a","value":{"n":1}}`,
+		`{"op":"put","path":"/old","value":{"n":2}}`,
+		`{"op":"delete","path":"/missing"}`,
+		`{"op":"put","path":"/b","value":{},"ifVersion":7}`,
+		`{"op":"delete","path":"/old"}`,
+	}, "\n"))
+
+	want := []int{http.StatusCreated, http.StatusOK, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusOK}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %v", len(want), results)
+	}
+	for i, result := range results {
+		if result.Index != i || result.Status != want[i] {
+			t.Errorf("Result %d is %+v, want status %d", i, result, want[i])
+		}
+	}
+	if results[0].ETag == "" {
+		t.Error("Expected an ETag for the created document")
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/a", "", http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/old", "", http.StatusNotFound)
+}
+
+func TestBulkArrayStopsAtUndecodableOperation(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+
+	w := mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_bulk", `[{"op":"put","path":"/a","value":1}, {"op":`, http.StatusOK)
+	var results []bulkResult
+	decode(t, w, &results)
+	if len(results) != 2 || results[0].Status != http.StatusCreated || results[1].Status != http.StatusBadRequest {
+		t.Fatalf("Expected a created document and a decoding error, got %+v", results)
+	}
+}
+
+// TestBulkChecksEachOperationsPath checks that a writer on part of a database can write
+// there in bulk and in transactions, but nowhere else.
+func TestBulkChecksEachOperationsPath(t *testing.T) {
+	ds := newTestService(t)
+	ds.SetAdmins([]string{"root"})
+	ds.EnableAccessControl()
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/orders", `{}`, http.StatusCreated)
+	grantRole(t, ds, "bob", "/v1/db/orders", "writer")
+
+	results := bulkResults(t, ds, "bob", "/v1/db/_bulk", strings.Join([]string{
+		`{"op":"put","path":"/orders","value":{"n":1}}`,
+		`{"op":"put","path":"/other","value":{}}`,
+	}, "\n"))
+	if len(results) != 2 || results[0].Status != http.StatusOK || results[1].Status != http.StatusForbidden {
+		t.Fatalf("Expected the write to /orders to succeed and /other to be forbidden, got %+v", results)
+	}
+
+	mustDo(t, ds, "bob", http.MethodPost, "/v1/db/_transaction", `[{"op":"put","path":"/orders","value":{"n":2}}]`, http.StatusOK)
+	mustDo(t, ds, "bob", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"put","path":"/orders","value":{"n":3}},
+		{"op":"put","path":"/other","value":{}}
+	]`, http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[{"op":"put","path":"/orders","value":{}}]`, http.StatusForbidden)
+}
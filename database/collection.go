@@ -4,26 +4,93 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
 )
 
 // The Collection struct represents a collection in a database.
 type Collection struct {
-	Name      string                               `json:"-"`
-	Documents skiplist.SkipList[string, *Document] `json:"-"`
-	URI       string                               `json:"uri"`
+	Name            string                               `json:"-"`
+	Documents       skiplist.SkipList[string, *Document] `json:"-"`
+	URI             string                               `json:"uri"`
+	search          *searchIndex                         // Full-text index, nil if the collection has none
+	size            atomic.Int64                         // Number of documents in the collection
+	subcollections  atomic.Int64                         // Number of collections held by its documents
+	bytes           atomic.Int64                         // Approximate size of its documents' data as JSON
+	registry        *collectionRegistry                  // Nested collections by name, only kept for databases
+	ownerOnlyWrites atomic.Bool                          // Whether only creators may change documents, only set on databases
+	metaMu          sync.Mutex                           // Guards meta, which readers see without ds.mu
+	meta            Metadata                             // Creation and last write of the collection
 }
 
-// NewCollection creates and returns a new Collection struct with the given name.
-func NewCollection(name string, uri string) *Collection {
+// NewCollection creates and returns a new Collection struct with the given name, created by
+// the user at the given time.
+func NewCollection(name string, user string, time time.Time, uri string) *Collection {
 	return &Collection{
 		Name:      name,
 		Documents: skiplist.NewSkipList[string, *Document](),
 		URI:       uri,
+		meta:      *NewMetadata(user, time),
 	}
 }
 
+// storeDocument inserts or replaces the named document and keeps the collection's indexes up to date.
+// The new document gets a version higher than any before it. If check is not nil, the document is
+// only stored if check accepts the current version; the check is made inside the skip list update.
+func (c *Collection) storeDocument(name string, doc *Document, check precondition) error {
+	var previous *Document
+	updateFunc := func(key string, currValue *Document, exists bool) (*Document, error) {
+		if check != nil {
+			if err := check(currValue, exists); err != nil {
+				return nil, err
+			}
+		}
+		previous = nil
+		if exists {
+			previous = currValue
+		}
+		doc.Version = nextVersion()
+		return doc, nil
+	}
+	doc.bytes = dataBytes(doc.Data)
+	if _, err := c.Documents.Upsert(name, updateFunc); err != nil {
+		return err
+	}
+	c.bytes.Add(doc.bytes)
+	c.subcollections.Add(countCollections(doc))
+	if previous == nil {
+		c.size.Add(1)
+	} else {
+		c.bytes.Add(-previous.bytes)
+		c.subcollections.Add(-countCollections(previous))
+	}
+	c.modified(doc.Metadata.LastModifiedBy, doc.Metadata.LastModifiedAt)
+	if c.search != nil {
+		c.search.add(name, doc.Data)
+	}
+	return nil
+}
+
+// removeDocument removes the named document, on behalf of the user, and drops it from the
+// collection's indexes.
+func (c *Collection) removeDocument(name string, user string) (*Document, bool) {
+	doc, ok := c.Documents.Remove(name)
+	if !ok {
+		return nil, false
+	}
+	c.size.Add(-1)
+	c.bytes.Add(-doc.bytes)
+	c.subcollections.Add(-countCollections(doc))
+	c.modified(user, time.Now())
+	if c.search != nil {
+		c.search.remove(name)
+	}
+	return doc, ok
+}
+
 // GetChildByName implements the function from the PathItem interface.
 // If it exists, it returns the document and true, otherwise nil and false.
 func (c *Collection) GetChildByName(name string) (PathItem, bool) {
@@ -37,22 +104,21 @@ func (c *Collection) GetChildByName(name string) (PathItem, bool) {
 // Marshal implements the function from the PathItem interface.
 // Calling Marshal() marshals and returns the collection as well as an error.
 func (c *Collection) Marshal() ([]byte, error) {
-	ctx := context.TODO()
+	return c.MarshalQuery(context.TODO(), &collectionQuery{})
+}
 
-	// Query for nodes
-	documentPairs, err := c.Documents.Query(ctx,
-		c.Documents.(*skiplist.SkipListImpl[string, *Document]).Head.Pair.Key,
-		c.Documents.(*skiplist.SkipListImpl[string, *Document]).Tail.Pair.Key)
+// MarshalQuery marshals the documents of the collection selected by the query.
+func (c *Collection) MarshalQuery(ctx context.Context, query *collectionQuery) ([]byte, error) {
+	documents := []*Document{}
+	// Append each selected document to the slice
+	err := query.run(ctx, c, func(doc *Document) bool {
+		documents = append(documents, doc)
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var documents []*Document
-	// Append each document to the slice
-	for _, pair := range documentPairs {
-		documents = append(documents, pair.Value)
-	}
-
 	// Marshal the entire slice into its JSON representation
 	return json.Marshal(documents)
 }
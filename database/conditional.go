@@ -0,0 +1,135 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// errPreconditionFailed is returned when a conditional write does not match the current
+// version of the document.
+var errPreconditionFailed = errors.New("Precondition failed")
+
+// A precondition is checked against the current version of a document, inside the skip
+// list update that replaces it. Current is nil if exists is false.
+type precondition func(current *Document, exists bool) error
+
+// lastVersion is the version most recently given to a document. Every document draws its
+// versions from this one counter, so a document that is deleted and created again never
+// reuses an earlier version, and a stale ETag cannot match the new document.
+var lastVersion atomic.Uint64
+
+// nextVersion returns a version that no document has had before.
+func nextVersion() uint64 {
+	return lastVersion.Add(1)
+}
+
+// ETag returns the entity tag of the document's current version.
+func (d *Document) ETag() string {
+	return "\"" + strconv.FormatUint(d.Version, 10) + "\""
+}
+
+// parsePrecondition reads the If-Match and If-None-Match headers and the ifversion
+// parameter of a write request. It returns nil if the request is unconditional.
+// The parameter is for clients that cannot set headers; ifversion=0 means that the
+// document must not exist yet.
+func parsePrecondition(r *http.Request) (precondition, error) {
+	ifMatch, hasIfMatch := r.Header["If-Match"]
+	ifNoneMatch, hasIfNoneMatch := r.Header["If-None-Match"]
+	ifVersion, hasIfVersion := r.URL.Query()["ifversion"]
+	if !hasIfMatch && !hasIfNoneMatch && !hasIfVersion {
+		return nil, nil
+	}
+
+	version := uint64(0)
+	if hasIfVersion {
+		var err error
+		if version, err = strconv.ParseUint(ifVersion[0], 10, 64); err != nil {
+			return nil, errors.New("ifversion must be a version number")
+		}
+	}
+
+	return func(current *Document, exists bool) error {
+		if hasIfMatch && !(exists && etagMatches(ifMatch, current)) {
+			return errPreconditionFailed
+		}
+		if hasIfNoneMatch && exists && etagMatches(ifNoneMatch, current) {
+			return errPreconditionFailed
+		}
+		if hasIfVersion {
+			if version == 0 && exists || version != 0 && (!exists || current.Version != version) {
+				return errPreconditionFailed
+			}
+		}
+		return nil
+	}, nil
+}
+
+// etagMatches reports whether any entity tag in the header values names the document's
+// version. The wildcard "*" matches any existing document.
+func etagMatches(values []string, doc *Document) bool {
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			// Versions are exact, so weak and strong tags compare the same.
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == doc.ETag() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errDocumentMissing is returned when an update-only write finds no document.
+var errDocumentMissing = errors.New("Document does not exist")
+
+// mustNotExist only accepts a write that creates the document.
+func mustNotExist(current *Document, exists bool) error {
+	if exists {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// mustExist only accepts a write that replaces an existing document.
+func mustExist(current *Document, exists bool) error {
+	if !exists {
+		return errDocumentMissing
+	}
+	return nil
+}
+
+// parseWriteMode reads the mode parameter of a PUT. With mode=create the document must
+// not exist yet, and with mode=update it must already exist. It returns nil if the
+// request may do either.
+func parseWriteMode(r *http.Request) (precondition, error) {
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "":
+		return nil, nil
+	case "create":
+		return mustNotExist, nil
+	case "update":
+		return mustExist, nil
+	default:
+		return nil, fmt.Errorf("unknown write mode %q", mode)
+	}
+}
+
+// allOf combines preconditions into one that accepts a write only if all of them do,
+// checking them in order. Nil preconditions are skipped.
+func allOf(checks ...precondition) precondition {
+	return func(current *Document, exists bool) error {
+		for _, check := range checks {
+			if check == nil {
+				continue
+			}
+			if err := check(current, exists); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	etag := mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusCreated).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag on PUT")
+	}
+
+	r := newRequest("alice", http.MethodPut, "/v1/db/d", `{"n":2}`)
+	r.Header.Set("If-Match", etag)
+	if w := serve(ds, r); w.Code != http.StatusOK {
+		t.Fatalf("Matching If-Match failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	// The first ETag no longer matches.
+	r = newRequest("alice", http.MethodPut, "/v1/db/d", `{"n":3}`)
+	r.Header.Set("If-Match", etag)
+	if w := serve(ds, r); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Stale If-Match answered %d, want 412", w.Code)
+	}
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d?ifversion=0", `{}`, http.StatusPreconditionFailed)
+}
+
+// TestStaleETagAfterRecreate checks that a document deleted and created again does not
+// match the ETag of the document it replaced.
+func TestStaleETagAfterRecreate(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	stale := mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusCreated).Header().Get("ETag")
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/d", "", http.StatusNoContent)
+	fresh := mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusCreated).Header().Get("ETag")
+	if fresh == stale {
+		t.Fatalf("Recreated document reused ETag %s", stale)
+	}
+
+	r := newRequest("alice", http.MethodDelete, "/v1/db/d", "")
+	r.Header.Set("If-Match", stale)
+	if w := serve(ds, r); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Stale If-Match on a recreated document answered %d, want 412", w.Code)
+	}
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/d?ifversion="+stale[1:len(stale)-1], "", http.StatusPreconditionFailed)
+}
+
+func TestWriteModes(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d?mode=update", `{"n":1}`, http.StatusNotFound)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d", "", http.StatusNotFound)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d?mode=create", `{"n":1}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d?mode=create", `{"n":2}`, http.StatusPreconditionFailed)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d?mode=update", `{"n":3}`, http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d?mode=upsert", `{"n":4}`, http.StatusBadRequest)
+	if got := documentData(t, ds, "alice", "/v1/db/d"); got["n"] != 3.0 {
+		t.Errorf("Document is %v, want n=3", got)
+	}
+}
+
+// TestConcurrentCreateOnlyWrites checks that of many concurrent create-only writes of the
+// same document, exactly one succeeds.
+func TestConcurrentCreateOnlyWrites(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+
+	const writers = 20
+	codes := make(chan int, writers)
+	for i := 0; i < writers; i++ {
+		go func() {
+			codes <- do(t, ds, "alice", http.MethodPut, "/v1/db/d?mode=create", `{}`).Code
+		}()
+	}
+	created := 0
+	for i := 0; i < writers; i++ {
+		switch code := <-codes; code {
+		case http.StatusCreated:
+			created++
+		case http.StatusPreconditionFailed:
+		default:
+			t.Errorf("Create-only write answered %d", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d create-only writes succeeded, want 1", created)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,10 +20,13 @@ import (
 // All documents and collections are stored recursively within the DatabaseService.
 // It contains a method to address each of the HTTP methods.
 type DatabaseService struct {
-	mu              sync.Mutex
+	mu              sync.RWMutex // Held for writing by writers, and for reading while a GET reads the tree
 	auth            *authorization.AuthHandler
 	collections     skiplist.SkipList[string, *Collection]
 	schemaValidator jsonschema.SchemaValidator
+	subs            *subHandler
+	triggers        []TriggerRegistration
+	acl             *accessControl // Roles of users
 }
 
 func GenerateUpdateCheck[K cmp.Ordered, V any](valueToAdd V) skiplist.UpdateCheck[K, V] {
@@ -32,11 +37,15 @@ func GenerateUpdateCheck[K cmp.Ordered, V any](valueToAdd V) skiplist.UpdateChec
 }
 
 // NewDatabaseService creates and returns a new DatabaseService struct.
-func NewDatabaseService(auth *authorization.AuthHandler, s jsonschema.SchemaValidator) *DatabaseService {
+// The triggers are run around every document write whose path they match.
+func NewDatabaseService(auth *authorization.AuthHandler, s jsonschema.SchemaValidator, triggers ...TriggerRegistration) *DatabaseService {
 	var ds DatabaseService
 	ds.collections = skiplist.NewSkipList[string, *Collection]()
 	ds.auth = auth
 	ds.schemaValidator = s
+	ds.subs = NewSubHandler()
+	ds.triggers = triggers
+	ds.acl = newAccessControl()
 	return &ds
 }
 
@@ -45,7 +54,7 @@ func (ds *DatabaseService) DBMethods(w http.ResponseWriter, r *http.Request) {
 		ds.HandleOptions(w, r)
 		return
 	}
-	
+
 	if ds.auth.CheckToken(r.Header.Get("Authorization")) != true {
 		w.Header().Add("WWW-Authenticate", "Bearer")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -55,6 +64,53 @@ func (ds *DatabaseService) DBMethods(w http.ResponseWriter, r *http.Request) {
 
 	slog.Info("checking token succeeded")
 
+	// Every request needs a role on its path when access control is enabled.
+	user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+	// Deleting a database needs an admin of it, such as its creator, even when access
+	// control is not enforced.
+	if !ds.allowed(user, r.URL.Path, requiredRole(r)) || (deletesDatabase(r) && !ds.IsAdmin(user, r.URL.Path)) {
+		slog.Info("access denied", "user", user, "path", r.URL.Path)
+		sendForbidden(w)
+		return
+	}
+
+	// Requests on a trailing action segment are dispatched to their own handlers.
+	switch path, action := splitAction(r.URL.Path); {
+	case action == "_aggregate" && r.Method == http.MethodGet:
+		slog.Info("GET called on aggregate")
+		ds.HandleAggregate(w, r, path)
+		return
+	case action == "_transaction" && r.Method == http.MethodPost:
+		slog.Info("POST called on transaction")
+		ds.HandleTransaction(w, r, path)
+		return
+	case action == "_bulk" && r.Method == http.MethodPost:
+		slog.Info("POST called on bulk")
+		ds.HandleBulk(w, r, path)
+		return
+	case (action == "_copy" || action == "_move") && r.Method == http.MethodPost:
+		slog.Info("POST called on "+action, "path", path)
+		ds.HandleRelocate(w, r, path, action == "_move")
+		return
+	case action == "_meta" && (r.Method == http.MethodGet || r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		slog.Info(r.Method+" called on meta", "path", path)
+		ds.HandleMeta(w, r, path)
+		return
+	case action == "_policy" && (r.Method == http.MethodGet || r.Method == http.MethodPut):
+		slog.Info(r.Method+" called on policy", "path", path)
+		ds.HandlePolicy(w, r, path)
+		return
+	case action == "_owner" && r.Method == http.MethodPut:
+		slog.Info("PUT called on owner", "path", path)
+		ds.HandleOwner(w, r, path)
+		return
+	}
+	if database, name, ok := splitGroupPath(r.URL.Path); ok && r.Method == http.MethodGet {
+		slog.Info("GET called on collection group", "collection", name)
+		ds.HandleGroupQuery(w, r, database, name)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		slog.Info("GET called on database")
@@ -82,6 +138,7 @@ func (ds *DatabaseService) DBMethods(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ds *DatabaseService) HandleGet(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
 
 	// Set header for response.
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -93,49 +150,86 @@ func (ds *DatabaseService) HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Lock the database.
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
+	// Find the item. Reads walk the same skip lists writers update, so writers are held
+	// off until the response has been built. Streams and subscriptions release the lock
+	// before they write to the client.
+	release := sync.OnceFunc(ds.mu.RUnlock)
+	ds.mu.RLock()
+	defer release()
+	currentItem, notFound := ds.resolveForRead(pathParts)
+	if currentItem == nil {
+		sendErrorResponse(w, http.StatusNotFound, notFound)
+		return
+	}
+	resolved := time.Now()
 
-	// Initalize currentItem to the database in the path.
-	var currentItem PathItem
-	collection, exists := ds.collections.Find(pathParts[1])
-	if !exists {
-		sendErrorResponse(w, http.StatusNotFound, "\"Database does not exist\"")
+	// Handle subscribe. Subscriptions release the lock once their initial state is read.
+	if r.URL.Query().Get("mode") == "subscribe" {
+		ds.HandleSubscribe(w, r, pathParts, currentItem, release)
 		return
 	}
-	currentItem = collection
 
-	// Start from index 2 since we've already processed the database.
-	for _, part := range pathParts[2:] {
-		nextItem, exists := currentItem.GetChildByName(part)
-		if !exists {
-			if len(pathParts)%2 == 0 {
-				sendErrorResponse(w, http.StatusNotFound, "\"Collection does not exist\"")
-				return
-			} else {
-				sendErrorResponse(w, http.StatusNotFound, "\"Document does not exist\"")
-				return
-			}
+	// Statistics are kept for collections and databases.
+	if r.URL.Query().Get("mode") == "stats" {
+		collection, ok := currentItem.(*Collection)
+		if !ok {
+			sendErrorResponse(w, http.StatusBadRequest, "\"Statistics are only kept for collections\"")
+			return
 		}
-		currentItem = nextItem
+		writeStats(w, r, collection, len(pathParts) == 2)
+		return
 	}
 
-	// Marshall the item.
-	response, err := currentItem.Marshal()
+	// Marshall the item. Collections only include the documents selected by the query.
+	var response []byte
+	if collection, ok := currentItem.(*Collection); ok {
+		if _, ok := r.URL.Query()["pointer"]; ok {
+			sendErrorResponse(w, http.StatusBadRequest, "\"Pointer reads require a document\"")
+			return
+		}
+		query, err := parseCollectionQuery(r.URL.Query())
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		// Explained queries return their plan instead of their results.
+		if query.stats != nil {
+			writeExplain(w, r, collection, query, started, resolved)
+			return
+		}
+		// Full-text searches return ranked document names instead of documents.
+		if text, ok := r.URL.Query()["search"]; ok {
+			writeSearchResults(w, collection, text[0], query)
+			return
+		}
+		// Documents are streamed to the client in chunks, without holding the lock
+		// while they are written.
+		ds.writeCollectionStream(w, r, collection, query, release)
+		return
+	} else if pointer, ok := r.URL.Query()["pointer"]; ok {
+		// Pointer reads return only the referenced sub-value of a document.
+		value, err := currentItem.(*Document).Lookup(pointer[0])
+		if err == errPointerNotFound {
+			sendErrorResponse(w, http.StatusNotFound, "\"Pointer does not resolve\"")
+			return
+		}
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		response, err = json.Marshal(value)
+	} else {
+		response, err = currentItem.Marshal()
+	}
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Handle subscribe.
-	if r.URL.Query().Get("mode") == "subscribe" {
-		subInst := NewSubHandler()
-		http.Handle(r.URL.Path, subInst)
-		http.HandleFunc(r.URL.Path, subInst.MessageHandler)
-	}
-
 	// Successful GET request.
+	if doc, ok := currentItem.(*Document); ok {
+		w.Header().Set("ETag", doc.ETag())
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(response)
@@ -182,7 +276,12 @@ func (ds *DatabaseService) HandlePut(w http.ResponseWriter, r *http.Request) {
 			sendErrorResponse(w, http.StatusBadRequest, "\"unable to create database "+collectionName+": exists\"")
 			return
 		}
-		newCollection := NewCollection(collectionName, r.URL.Path)
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		newCollection := NewCollection(collectionName, user, time.Now(), r.URL.Path)
+		if err := configureSearch(newCollection, r.URL.Query()); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
 		updateFunc := GenerateUpdateCheck[string, *Collection](newCollection)
 		ds.collections.Upsert(collectionName, updateFunc)
 		response, err := newCollection.MarshalURI()
@@ -225,13 +324,31 @@ func (ds *DatabaseService) HandlePut(w http.ResponseWriter, r *http.Request) {
 	if len(pathParts)%2 == 0 { // Collection
 		slog.Info("PUT case Collection")
 		collectionName := pathParts[len(pathParts)-1]
-		newCollection := NewCollection(collectionName, r.URL.Path)
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		newCollection := NewCollection(collectionName, user, time.Now(), r.URL.Path)
+		if err := configureSearch(newCollection, r.URL.Query()); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		previous, replaced := currentItem.(*Document).Collections.Find(collectionName)
+		if replaced {
+			if err := ds.collectionOwnerCheck(r.Context(), pathParts, previous, user); err != nil {
+				sendErrorResponse(w, http.StatusForbidden, jsonString(err.Error()))
+				return
+			}
+		}
 		updateFunc := GenerateUpdateCheck[string, *Collection](newCollection)
 		_, upsertErr := currentItem.(*Document).Collections.Upsert(collectionName, updateFunc)
 		if upsertErr != nil {
-			sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+			sendErrorResponse(w, http.StatusInternalServerError, upsertErr.Error())
 			return
 		}
+		if replaced {
+			ds.collectionRemoved(pathParts, previous, true)
+		} else {
+			ds.collectionAdded(pathParts, 1)
+		}
+		ds.registerCollection(pathParts[1], newCollection)
 		response, err := newCollection.MarshalURI()
 		if err != nil {
 			sendErrorResponse(w, http.StatusInternalServerError, err.Error())
@@ -253,30 +370,76 @@ func (ds *DatabaseService) HandlePut(w http.ResponseWriter, r *http.Request) {
 			sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
 			return
 		}
-		docName := pathParts[len(pathParts)-1]
-		// Check if the document is being created for the first time or being overriden
-		override := false
-		_, exists := currentItem.(*Collection).Documents.Find(docName)
-		if exists {
-			override = true
+		conditional, err := parsePrecondition(r)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		mode, err := parseWriteMode(r)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		labels, _, err := parseLabelsHeader(r)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
 		}
+		docName := pathParts[len(pathParts)-1]
 		var data interface{}
 		if err := json.Unmarshal(body, &data); err != nil {
 			sendErrorResponse(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		newDocument := NewDocument("/"+docName, data, "server", time.Now(), r.URL.Path)
-		updateFunc := GenerateUpdateCheck[string, *Document](newDocument)
-		_, upsertErr := currentItem.(*Collection).Documents.Upsert(docName, updateFunc)
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		event := WriteEvent{Path: pathKey(pathParts), User: user, Data: data}
+		if previous, exists := currentItem.(*Collection).Documents.Find(docName); exists {
+			event.Previous = previous.Data
+		}
+		if err := ds.beforeWrite(&event); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		newDocument := NewDocument("/"+docName, event.Data, user, time.Now(), r.URL.Path)
+		newDocument.Metadata.Labels = labels
+		// Whether the document is being created for the first time or being overriden is
+		// decided inside the update, together with the conditions on the write. An
+		// overwritten document keeps its creation metadata, and its labels unless the
+		// request sets new ones.
+		override := false
+		check := allOf(conditional, mode, ds.ownerCheck(pathParts, user), func(current *Document, exists bool) error {
+			override = exists
+			if exists {
+				newDocument.Metadata.keepCreation(current.Metadata)
+				newDocument.Metadata.keepLabels(current.Metadata)
+			}
+			return nil
+		})
+		upsertErr := currentItem.(*Collection).storeDocument(docName, newDocument, check)
+		if upsertErr == errPreconditionFailed {
+			sendErrorResponse(w, http.StatusPreconditionFailed, jsonString(upsertErr.Error()))
+			return
+		}
+		if upsertErr == errDocumentMissing {
+			sendErrorResponse(w, http.StatusNotFound, jsonString(upsertErr.Error()))
+			return
+		}
+		if upsertErr == errNotOwner {
+			sendErrorResponse(w, http.StatusForbidden, jsonString(upsertErr.Error()))
+			return
+		}
 		if upsertErr != nil {
-			sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+			sendErrorResponse(w, http.StatusInternalServerError, upsertErr.Error())
 			return
 		}
+		ds.notifyUpdate(pathParts, newDocument)
+		ds.afterWrite(event)
 		response, err := newDocument.MarshalURI()
 		if err != nil {
 			sendErrorResponse(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		w.Header().Set("ETag", newDocument.ETag())
 		w.Header().Set("Content-Type", "application/json")
 		// Overriding/Creating a document have different response codes
 		if override {
@@ -298,6 +461,13 @@ func (ds *DatabaseService) HandlePost(w http.ResponseWriter, r *http.Request) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
+	// A POST on a collection, written with a trailing slash, creates a document under a
+	// name generated by the server. A database is always a collection.
+	if len(pathParts)%2 == 0 && (strings.HasSuffix(r.URL.Path, "/") || len(pathParts) == 2) {
+		ds.postGeneratedDocument(w, r, pathParts)
+		return
+	}
+
 	var currentItem PathItem
 	collection, exists := ds.collections.Find(pathParts[1])
 	if !exists {
@@ -322,30 +492,57 @@ func (ds *DatabaseService) HandlePost(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Collection already exists", http.StatusConflict)
 			return
 		}
-		newCollection := NewCollection(collectionName, r.URL.Path)
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		newCollection := NewCollection(collectionName, user, time.Now(), r.URL.Path)
+		if err := configureSearch(newCollection, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		updateFunc := GenerateUpdateCheck[string, *Collection](newCollection)
-		currentItem.(*Document).Collections.Upsert(collectionName, updateFunc)
-	} else { // Odd length, so it's a document
-		docName := pathParts[len(pathParts)-1]
-		_, exists := currentItem.(*Collection).Documents.Find(docName)
-		if exists {
-			http.Error(w, "Document already exists", http.StatusConflict)
+		if _, err := currentItem.(*Document).Collections.Upsert(collectionName, updateFunc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		ds.collectionAdded(pathParts, 1)
+		ds.registerCollection(pathParts[1], newCollection)
+	} else { // Odd length, so it's a document
+		docName := pathParts[len(pathParts)-1]
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		var data interface{}
-		if err := json.Unmarshal(body, &data); err != nil {
+		if err := json.Unmarshal(body, &data); err != nil || ds.schemaValidator.ValidateData(body) != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte("Invalid JSON format"))
 			return
 		}
-		newDocument := NewDocument(docName, data, "server", time.Now(), r.URL.Path)
-		updateFunc := GenerateUpdateCheck[string, *Document](newDocument)
-		currentItem.(*Collection).Documents.Upsert(docName, updateFunc)
+		labels, _, err := parseLabelsHeader(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		event := WriteEvent{Path: pathKey(pathParts), User: user, Data: data}
+		if err := ds.beforeWrite(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		newDocument := NewDocument("/"+docName, event.Data, user, time.Now(), r.URL.Path)
+		newDocument.Metadata.Labels = labels
+		// The document is only created if it does not exist when the update runs.
+		err = currentItem.(*Collection).storeDocument(docName, newDocument, mustNotExist)
+		if err == errPreconditionFailed {
+			http.Error(w, "Document already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ds.notifyUpdate(pathParts, newDocument)
+		ds.afterWrite(event)
 	}
 	w.Header().Add("Access-Control-Allow-Origin", "*")
 	w.WriteHeader(http.StatusCreated)
@@ -407,14 +604,23 @@ func (ds *DatabaseService) HandlePatch(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Document not found", http.StatusNotFound)
 			return
 		}
-		decoder := json.NewDecoder(r.Body)
-		var updatedDoc Document
-		if err := decoder.Decode(&updatedDoc); err != nil {
-			http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		conditional, err := parsePrecondition(r)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		check := allOf(conditional, ds.ownerCheck(pathParts, user))
+		switch requestMediaType(r) {
+		case jsonPatchMediaType:
+			ds.handleJSONPatch(w, r, pathParts, currentItem.(*Collection), target, check)
+			return
+		case mergePatchMediaType:
+			ds.handleMergePatch(w, r, pathParts, currentItem.(*Collection), target, check)
 			return
 		}
-		target.Data = updatedDoc.Data
-		target.URI = updatedDoc.URI
+		ds.handleOperationPatch(w, r, pathParts, currentItem.(*Collection), target, check)
+		return
 	}
 	w.Header().Add("Access-Control-Allow-Origin", "*")
 	w.WriteHeader(http.StatusOK)
@@ -439,16 +645,23 @@ func (ds *DatabaseService) HandleDelete(w http.ResponseWriter, r *http.Request)
 		slog.Info("Delete case database")
 		collectionName := pathParts[1]
 		// Check if the database exists
-		_, exists := ds.collections.Find(collectionName)
+		database, exists := ds.collections.Find(collectionName)
 		if !exists {
 			sendErrorResponse(w, http.StatusNotFound, "\"Database does not exist\"")
 			return
 		}
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		if err := ds.collectionOwnerCheck(r.Context(), pathParts, database, user); err != nil {
+			sendErrorResponse(w, http.StatusForbidden, jsonString(err.Error()))
+			return
+		}
 		_, ok := ds.collections.Remove(collectionName)
 		if !ok {
 			sendErrorResponse(w, http.StatusInternalServerError, "\"Failed to remove database\"")
 			return
 		}
+		ds.acl.dropGrants(pathKey(pathParts))
+		ds.notifyDelete(pathParts)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -480,29 +693,58 @@ func (ds *DatabaseService) HandleDelete(w http.ResponseWriter, r *http.Request)
 	// Handle the final item in the path
 	if len(pathParts)%2 == 0 { // Collection
 		collectionName := pathParts[len(pathParts)-1]
-		_, exists := currentItem.(*Document).Collections.Find(collectionName)
+		current, exists := currentItem.(*Document).Collections.Find(collectionName)
 		if !exists {
 			sendErrorResponse(w, http.StatusNotFound, "\"Collection does not exist\"")
 			return
 		}
-		_, ok := currentItem.(*Document).Collections.Remove(collectionName)
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		if err := ds.collectionOwnerCheck(r.Context(), pathParts, current, user); err != nil {
+			sendErrorResponse(w, http.StatusForbidden, jsonString(err.Error()))
+			return
+		}
+		removed, ok := currentItem.(*Document).Collections.Remove(collectionName)
 		if !ok {
 			sendErrorResponse(w, http.StatusInternalServerError, "\"Failed to remove collection\"")
 			return
 		}
+		ds.collectionRemoved(pathParts, removed, false)
 	} else { // Document
 		docName := pathParts[len(pathParts)-1]
-		_, exists := currentItem.(*Collection).Documents.Find(docName)
+		current, exists := currentItem.(*Collection).Documents.Find(docName)
 		if !exists {
 			sendErrorResponse(w, http.StatusNotFound, "\"Document does not exist\"")
 			return
 		}
-		_, ok := currentItem.(*Collection).Documents.Remove(docName)
+		// Writers are serialized by ds.mu, so the document cannot change between this
+		// check and its removal.
+		check, err := parsePrecondition(r)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		if check != nil && check(current, true) != nil {
+			sendErrorResponse(w, http.StatusPreconditionFailed, jsonString(errPreconditionFailed.Error()))
+			return
+		}
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		if owner := ds.ownerCheck(pathParts, user); owner != nil && owner(current, true) != nil {
+			sendErrorResponse(w, http.StatusForbidden, jsonString(errNotOwner.Error()))
+			return
+		}
+		event := WriteEvent{Path: pathKey(pathParts), User: user, Previous: current.Data, Delete: true}
+		if err := ds.beforeWrite(&event); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		_, ok := currentItem.(*Collection).removeDocument(docName, user)
 		if !ok {
 			sendErrorResponse(w, http.StatusInternalServerError, "\"Failed to remove document\"")
 			return
 		}
+		ds.afterWrite(event)
 	}
+	ds.notifyDelete(pathParts)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -580,6 +822,88 @@ func (ds *DatabaseService) HandleOptions(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 }
 
+// resolveForRead finds the item at the end of the path. If the item does not exist it
+// returns nil and the error message to send. The caller must hold ds.mu for reading.
+func (ds *DatabaseService) resolveForRead(pathParts []string) (PathItem, string) {
+	// Initalize currentItem to the database in the path.
+	var currentItem PathItem
+	collection, exists := ds.collections.Find(pathParts[1])
+	if !exists {
+		return nil, "\"Database does not exist\""
+	}
+	currentItem = collection
+
+	// Start from index 2 since we've already processed the database.
+	for _, part := range pathParts[2:] {
+		nextItem, exists := currentItem.GetChildByName(part)
+		if !exists {
+			if len(pathParts)%2 == 0 {
+				return nil, "\"Collection does not exist\""
+			}
+			return nil, "\"Document does not exist\""
+		}
+		currentItem = nextItem
+	}
+	return currentItem, ""
+}
+
+// DocumentVersion returns the current version of the document a request path refers to,
+// ignoring a trailing action segment. It returns 0 if the path is not a document or the
+// document does not exist.
+func (ds *DatabaseService) DocumentVersion(path string) uint64 {
+	base, _ := splitAction(path)
+	pathParts, err := splitPath(base)
+	if err != nil || len(pathParts)%2 == 0 {
+		return 0
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	item, exists := ds.findItem(pathParts)
+	if !exists {
+		return 0
+	}
+	return item.(*Document).Version
+}
+
+// findItem walks the path from its database down and returns the item at the end of the path.
+// The second return value is false if any item along the path does not exist.
+func (ds *DatabaseService) findItem(pathParts []string) (PathItem, bool) {
+	var currentItem PathItem
+	database, exists := ds.collections.Find(pathParts[1])
+	if !exists {
+		return nil, false
+	}
+	currentItem = database
+
+	for _, part := range pathParts[2:] {
+		nextItem, exists := currentItem.GetChildByName(part)
+		if !exists {
+			return nil, false
+		}
+		currentItem = nextItem
+	}
+	return currentItem, true
+}
+
+// requestMediaType returns the media type of the request body without its parameters.
+func requestMediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// jsonString encodes a message as a JSON string for use in an error response.
+func jsonString(message string) string {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return "\"\""
+	}
+	return string(encoded)
+}
+
 func sendErrorResponse(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
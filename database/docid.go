@@ -0,0 +1,155 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// crockford is the alphabet of Crockford's base32, which leaves out I, L, O and U.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// generatedNameAttempts bounds the retries when a generated name is already taken.
+const generatedNameAttempts = 8
+
+// errNameTaken is returned when a generated document name is already in use.
+var errNameTaken = errors.New("Document name already exists")
+
+// A nameGenerator produces ULID style document names: a 48-bit millisecond timestamp
+// followed by 80 random bits, written as 26 characters of Crockford base32. Names made
+// in the same millisecond increment the random part, so names sort in creation order.
+type nameGenerator struct {
+	mu     sync.Mutex
+	last   uint64   // Millisecond of the last name
+	random [10]byte // Random part of the last name
+}
+
+// documentNames generates the names of documents created by POST on a collection.
+var documentNames nameGenerator
+
+// next returns a new name.
+func (g *nameGenerator) next() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := uint64(time.Now().UnixMilli())
+	if now > g.last || !g.increment() {
+		if _, err := rand.Read(g.random[:]); err != nil {
+			return "", err
+		}
+		g.last = max(now, g.last)
+	}
+
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], g.last<<16)
+	copy(id[6:], g.random[:])
+	return encodeCrockford(id), nil
+}
+
+// increment adds one to the random part. It returns false if the random part overflowed.
+func (g *nameGenerator) increment() bool {
+	for i := len(g.random) - 1; i >= 0; i-- {
+		g.random[i]++
+		if g.random[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCrockford writes 128 bits as 26 base32 characters, the first of which only
+// carries the top 3 bits.
+func encodeCrockford(id [16]byte) string {
+	high := binary.BigEndian.Uint64(id[:8])
+	low := binary.BigEndian.Uint64(id[8:])
+	var encoded [26]byte
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = crockford[low&31]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+	return string(encoded[:])
+}
+
+// postGeneratedDocument answers a POST on a collection path ending in a slash by creating
+// a document under a generated name. The name is claimed inside the skip list update, so a
+// concurrent write can never be overwritten. The caller must hold ds.mu.
+func (ds *DatabaseService) postGeneratedDocument(w http.ResponseWriter, r *http.Request, pathParts []string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	item, exists := ds.findItem(pathParts)
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Collection does not exist\"")
+		return
+	}
+	c := item.(*Collection)
+
+	var data interface{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Invalid JSON format\"")
+		return
+	}
+	body, err := json.Marshal(data)
+	if err != nil || ds.schemaValidator.ValidateData(body) != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Invalid JSON format\"")
+		return
+	}
+
+	labels, _, err := parseLabelsHeader(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+
+	user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+	unused := func(current *Document, exists bool) error {
+		if exists {
+			return errNameTaken
+		}
+		return nil
+	}
+	for attempt := 0; attempt < generatedNameAttempts; attempt++ {
+		name, err := documentNames.next()
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+		docParts := append(pathParts[:len(pathParts):len(pathParts)], name)
+		// Triggers see the final name, so they run again if it has to be regenerated.
+		event := WriteEvent{Path: pathKey(docParts), User: user, Data: data}
+		if err := ds.beforeWrite(&event); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		newDocument := NewDocument("/"+name, event.Data, user, time.Now(), pathKey(docParts))
+		newDocument.Metadata.Labels = labels
+		err = c.storeDocument(name, newDocument, unused)
+		if err == errNameTaken {
+			continue
+		}
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+
+		ds.notifyUpdate(docParts, newDocument)
+		ds.afterWrite(event)
+		response, err := newDocument.MarshalURI()
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+		w.Header().Set("ETag", newDocument.ETag())
+		w.Header().Set("Location", newDocument.URI)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(response)
+		return
+	}
+	sendErrorResponse(w, http.StatusInternalServerError, jsonString(errNameTaken.Error()))
+}
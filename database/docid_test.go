@@ -0,0 +1,68 @@
+package database
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeCrockford(t *testing.T) {
+	var id [16]byte
+	if got := encodeCrockford(id); got != strings.Repeat("0", 26) {
+		t.Errorf("Zero ID encoded as %s", got)
+	}
+	for i := range id {
+		id[i] = 0xff
+	}
+	if got := encodeCrockford(id); got != "7"+strings.Repeat("Z", 25) {
+		t.Errorf("Largest ID encoded as %s", got)
+	}
+}
+
+func TestGeneratedNamesAreOrdered(t *testing.T) {
+	var g nameGenerator
+	previous := ""
+	for i := 0; i < 1000; i++ {
+		name, err := g.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(name) != 26 || strings.Trim(name, crockford) != "" {
+			t.Fatalf("Name %q is not 26 characters of Crockford base32", name)
+		}
+		if name <= previous {
+			t.Fatalf("Name %s does not sort after %s", name, previous)
+		}
+		previous = name
+	}
+
+	// Names keep increasing if the clock goes back.
+	g.last = uint64(time.Now().Add(time.Hour).UnixMilli())
+	ahead, err := g.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := g.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= ahead {
+		t.Errorf("Name %s made after the clock went back does not sort after %s", next, ahead)
+	}
+}
+
+func TestPostGeneratesName(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	w := mustDo(t, ds, "alice", http.MethodPost, "/v1/db/", `{"n":1}`, http.StatusCreated)
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/v1/db/") || len(location) != len("/v1/db/")+26 {
+		t.Fatalf("Created document is at %q", location)
+	}
+	if got := documentData(t, ds, "alice", location); got["n"] != 1.0 {
+		t.Errorf("Created document holds %v", got)
+	}
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/", `{"n":`, http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/missing/c/", `{}`, http.StatusNotFound)
+}
@@ -15,6 +15,8 @@ type Document struct {
 	Collections skiplist.SkipList[string, *Collection] `json:"-"`
 	Metadata    Metadata                               `json:"meta"`
 	URI         string                                 `json:"-"`
+	Version     uint64                                 `json:"-"` // Incremented on every write, exposed as the ETag
+	bytes       int64                                  // Approximate size of Data as JSON, set when stored
 }
 
 // NewDocument creates and returns a new Document struct based on the inputs.
@@ -48,6 +50,16 @@ func (d *Document) Marshal() ([]byte, error) {
 	return response, nil
 }
 
+// Lookup returns the sub-value of the document's data that the JSON Pointer refers to.
+// It returns errPointerNotFound if the pointer does not resolve.
+func (d *Document) Lookup(pointer string) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePointer(d.Data, tokens)
+}
+
 // MarshalURI marshals only the URI field of the Document.
 func (d *Document) MarshalURI() ([]byte, error) {
 	uriStruct := struct {
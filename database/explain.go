@@ -0,0 +1,139 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
+)
+
+// rangeCountLimit is the most keys counted in a key range. The estimate of a larger range
+// is the size of the whole collection.
+const rangeCountLimit = 1000
+
+// A queryPlan describes how a collection query was executed. It is returned instead of
+// the query's results when the request has explain=true.
+type queryPlan struct {
+	Plan      string      `json:"plan"`  // fullScan, keyRange or searchIndex
+	Index     string      `json:"index"` // The index the documents were read from
+	Range     planRange   `json:"range"`
+	Filters   []string    `json:"filters"`
+	Search    string      `json:"search,omitempty"`
+	Order     string      `json:"order"`
+	Estimated int         `json:"estimatedDocuments"` // Documents in the key range, or the collection size for large ranges
+	Scanned   int         `json:"scannedDocuments"`
+	Returned  int         `json:"returnedDocuments"`
+	Stages    []planStage `json:"stages"`
+}
+
+// A planRange is the key interval a plan reads. Empty bounds are open.
+type planRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// A planStage is the time spent in one step of executing a query.
+type planStage struct {
+	Name     string `json:"name"`
+	Duration int64  `json:"durationMicros"`
+}
+
+// explainQuery executes the query against the collection, discarding its results, and
+// returns the plan that was used. Started and resolved are the times the request began
+// and the collection was found, so that path resolution is reported as its own stage.
+func explainQuery(c *Collection, r *http.Request, query *collectionQuery, started, resolved time.Time) (*queryPlan, error) {
+	plan := &queryPlan{
+		Plan:    "fullScan",
+		Index:   "primary",
+		Range:   planRange{Start: query.start, End: query.end},
+		Filters: []string{},
+		Order:   "key",
+		Stages:  []planStage{{Name: "resolve", Duration: resolved.Sub(started).Microseconds()}},
+	}
+	for _, f := range query.labels {
+		plan.Filters = append(plan.Filters, "label "+f.key+":"+f.value)
+	}
+	for _, f := range query.filters {
+		plan.Filters = append(plan.Filters, f.raw)
+	}
+
+	readStage := "scan"
+	executed := time.Now()
+	if text, ok := r.URL.Query()["search"]; ok {
+		if c.search == nil {
+			return nil, errNoSearchIndex
+		}
+		readStage = "search"
+		plan.Plan = "searchIndex"
+		plan.Index = "search"
+		plan.Search = text[0]
+		plan.Order = "score"
+		plan.Estimated = c.search.estimate(text[0])
+		searchCollection(c, text[0], query)
+	} else {
+		plan.Estimated = int(c.size.Load())
+		if query.start != "" || query.end != "" {
+			plan.Plan = "keyRange"
+			estimated, err := countRange(r, c, query)
+			if err != nil {
+				return nil, err
+			}
+			plan.Estimated = estimated
+		}
+		err := query.run(r.Context(), c, func(*Document) bool { return true })
+		if err != nil {
+			return nil, err
+		}
+	}
+	elapsed := time.Since(executed)
+
+	// Time spent outside of the filters was spent reading the index.
+	plan.Stages = append(plan.Stages,
+		planStage{Name: readStage, Duration: (elapsed - query.stats.filterTime).Microseconds()},
+		planStage{Name: "filter", Duration: query.stats.filterTime.Microseconds()},
+	)
+	plan.Scanned = query.stats.scanned
+	plan.Returned = query.stats.returned
+	return plan, nil
+}
+
+// countRange counts the documents in the query's key range by walking it, stopping after
+// rangeCountLimit keys. If the range holds more, the size of the collection is returned
+// as an upper bound. The walk reads the keys the query itself reads next, so it at most
+// doubles the cost of explaining a query.
+func countRange(r *http.Request, c *Collection, query *collectionQuery) (int, error) {
+	counted := 0
+	err := c.Documents.Scan(r.Context(), query.start, query.end, func(skiplist.Pair[string, *Document]) bool {
+		counted++
+		return counted < rangeCountLimit
+	})
+	if err != nil {
+		return 0, err
+	}
+	if counted >= rangeCountLimit {
+		return max(counted, int(c.size.Load())), nil
+	}
+	return counted, nil
+}
+
+// writeExplain answers a collection GET with explain=true.
+func writeExplain(w http.ResponseWriter, r *http.Request, c *Collection, query *collectionQuery, started, resolved time.Time) {
+	plan, err := explainQuery(c, r, query, started, resolved)
+	if err == errNoSearchIndex {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	response, err := json.Marshal(plan)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
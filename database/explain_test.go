@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestExplainEstimatesKeyRange(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	for i := 0; i < 10; i++ {
+		mustDo(t, ds, "alice", http.MethodPut, fmt.Sprintf("/v1/db/d%d", i), `{"n":1}`, http.StatusCreated)
+	}
+
+	var plan queryPlan
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/?explain=true&interval=[d2,d4]", "", http.StatusOK), &plan)
+	if plan.Plan != "keyRange" {
+		t.Errorf("Expected a keyRange plan, got %q", plan.Plan)
+	}
+	if plan.Estimated != 3 || plan.Scanned != 3 {
+		t.Errorf("Expected 3 estimated and scanned documents, got %d and %d", plan.Estimated, plan.Scanned)
+	}
+
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/?explain=true", "", http.StatusOK), &plan)
+	if plan.Plan != "fullScan" || plan.Estimated != 10 {
+		t.Errorf("Expected a fullScan of 10 documents, got %q of %d", plan.Plan, plan.Estimated)
+	}
+}
+
+// TestCountRangeStopsAtLimit checks that a key range too large to count is estimated by
+// the size of the collection.
+func TestCountRangeStopsAtLimit(t *testing.T) {
+	c := NewCollection("c", "alice", time.Now(), "/v1/db/c/")
+	for i := 0; i < rangeCountLimit+10; i++ {
+		name := fmt.Sprintf("d%05d", i)
+		c.storeDocument(name, NewDocument("/"+name, map[string]any{}, "alice", time.Now(), "/v1/db/c/"+name), nil)
+	}
+	query, err := parseCollectionQuery(url.Values{"interval": {"[d00005,]"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/v1/db/c/", nil)
+	if got, err := countRange(r, c, query); err != nil || got != rangeCountLimit+10 {
+		t.Errorf("Counting a large range gave %d, %v, want the collection size %d", got, err, rangeCountLimit+10)
+	}
+
+	query, err = parseCollectionQuery(url.Values{"interval": {"[d00100,d00199]"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := countRange(r, c, query); err != nil || got != 100 {
+		t.Errorf("Counting a range of 100 documents gave %d, %v", got, err)
+	}
+}
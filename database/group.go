@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
+)
+
+// A collectionRegistry indexes the nested collections of a database by name, so that
+// collection group queries do not have to walk the whole database. Entries are added
+// when collections are created and removed when collections are deleted or replaced.
+// Replacing or deleting a document drops its collections without bookkeeping, so entries
+// are also checked, and pruned if stale, when they are read. It is guarded by ds.mu.
+type collectionRegistry struct {
+	byName map[string]map[*Collection]struct{}
+}
+
+// A groupResult is a document found by a collection group query, with its full path.
+type groupResult struct {
+	Path     string   `json:"path"`
+	Data     any      `json:"doc"`
+	Metadata Metadata `json:"meta"`
+}
+
+// newCollectionRegistry builds a registry for a database by walking every document's
+// collections recursively.
+func newCollectionRegistry(ctx context.Context, database *Collection) (*collectionRegistry, error) {
+	registry := &collectionRegistry{byName: make(map[string]map[*Collection]struct{})}
+	err := walkCollections(ctx, database, registry.add)
+	if err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// add records a collection under its name.
+func (registry *collectionRegistry) add(c *Collection) {
+	if registry.byName[c.Name] == nil {
+		registry.byName[c.Name] = make(map[*Collection]struct{})
+	}
+	registry.byName[c.Name][c] = struct{}{}
+}
+
+// remove drops a collection, and every collection nested under it, from the registry.
+func (registry *collectionRegistry) remove(ctx context.Context, c *Collection) {
+	delete(registry.byName[c.Name], c)
+	walkCollections(ctx, c, func(nested *Collection) {
+		delete(registry.byName[nested.Name], nested)
+	})
+}
+
+// walkCollections calls visit on every collection nested under c, at any depth.
+func walkCollections(ctx context.Context, c *Collection, visit func(*Collection)) error {
+	var walkErr error
+	err := c.Documents.Scan(ctx, "", "", func(doc skiplist.Pair[string, *Document]) bool {
+		walkErr = doc.Value.Collections.Scan(ctx, "", "", func(sub skiplist.Pair[string, *Collection]) bool {
+			visit(sub.Value)
+			walkErr = walkCollections(ctx, sub.Value, visit)
+			return walkErr == nil
+		})
+		return walkErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return walkErr
+}
+
+// registerCollection records a newly created nested collection in its database's
+// registry, if the database has one yet. The caller must hold ds.mu.
+func (ds *DatabaseService) registerCollection(databaseName string, c *Collection) {
+	database, exists := ds.collections.Find(databaseName)
+	if exists && database.registry != nil {
+		database.registry.add(c)
+	}
+}
+
+// unregisterCollection drops a deleted or replaced nested collection, and everything
+// under it, from its database's registry. The caller must hold ds.mu.
+func (ds *DatabaseService) unregisterCollection(databaseName string, c *Collection) {
+	database, exists := ds.collections.Find(databaseName)
+	if exists && database.registry != nil {
+		database.registry.remove(context.TODO(), c)
+	}
+}
+
+// groupCollections returns every live collection with the given name in the database,
+// ordered by path. The caller must hold ds.mu.
+func (ds *DatabaseService) groupCollections(ctx context.Context, database *Collection, name string) ([]*Collection, error) {
+	if database.registry == nil {
+		registry, err := newCollectionRegistry(ctx, database)
+		if err != nil {
+			return nil, err
+		}
+		database.registry = registry
+	}
+
+	var collections []*Collection
+	for c := range database.registry.byName[name] {
+		// Drop collections that were deleted or replaced since they were registered.
+		pathParts, err := splitPath(c.URI)
+		if err != nil || len(pathParts)%2 != 0 {
+			delete(database.registry.byName[name], c)
+			continue
+		}
+		item, exists := ds.findItem(pathParts)
+		if !exists || item != PathItem(c) {
+			delete(database.registry.byName[name], c)
+			continue
+		}
+		collections = append(collections, c)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].URI < collections[j].URI
+	})
+	return collections, nil
+}
+
+// HandleGroupQuery answers GET /v1/{db}/_group/{name}, which queries every collection
+// with the given name anywhere under the database. It accepts the same interval and
+// where parameters as a collection GET, applied to each collection.
+func (ds *DatabaseService) HandleGroupQuery(w http.ResponseWriter, r *http.Request, databaseName string, name string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query, err := parseCollectionQuery(r.URL.Query())
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+
+	// Lock the database.
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	database, exists := ds.collections.Find(databaseName)
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Database does not exist\"")
+		return
+	}
+
+	collections, err := ds.groupCollections(r.Context(), database, name)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+
+	results := []groupResult{}
+	for _, c := range collections {
+		prefix := strings.TrimSuffix(c.URI, "/")
+		err := query.run(r.Context(), c, func(doc *Document) bool {
+			results = append(results, groupResult{
+				Path:     prefix + "/" + strings.TrimPrefix(doc.Name, "/"),
+				Data:     doc.Data,
+				Metadata: doc.Metadata,
+			})
+			return true
+		})
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+	}
+
+	response, err := json.Marshal(results)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
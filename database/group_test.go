@@ -0,0 +1,65 @@
+package database
+
+import (
+	"net/http"
+	"testing"
+)
+
+// groupPaths runs a collection group query and returns the paths of the documents found.
+func groupPaths(t *testing.T, ds *DatabaseService, path string) []string {
+	t.Helper()
+	var results []struct {
+		Path string `json:"path"`
+	}
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, path, "", http.StatusOK), &results)
+	var paths []string
+	for _, result := range results {
+		paths = append(paths, result.Path)
+	}
+	return paths
+}
+
+func TestGroupQueryFindsEveryLevel(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	for _, step := range []struct{ path, body string }{
+		{"/v1/db/u1", `{}`},
+		{"/v1/db/u2", `{}`},
+		{"/v1/db/u1/posts/", ""},
+		{"/v1/db/u1/posts/p", `{}`},
+		{"/v1/db/u1/posts/p/comments/", ""},
+		{"/v1/db/u1/posts/p/comments/z", `{"n":3}`},
+		{"/v1/db/u1/comments/", ""},
+		{"/v1/db/u1/comments/x", `{"n":1}`},
+		{"/v1/db/u2/comments/", ""},
+		{"/v1/db/u2/comments/y", `{"n":2}`},
+	} {
+		mustDo(t, ds, "alice", http.MethodPut, step.path, step.body, http.StatusCreated)
+	}
+
+	got := groupPaths(t, ds, "/v1/db/_group/comments")
+	want := []string{"/v1/db/u1/comments/x", "/v1/db/u1/posts/p/comments/z", "/v1/db/u2/comments/y"}
+	if len(got) != len(want) {
+		t.Fatalf("Group query found %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Result %d is %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	if got := groupPaths(t, ds, "/v1/db/_group/comments?where=/n>=2"); len(got) != 2 {
+		t.Errorf("Filtered group query found %v, want 2 documents", got)
+	}
+
+	// Collections created after the registry was built, and deleted documents holding
+	// collections, are both seen by later queries.
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/u3", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/u3/comments/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/u3/comments/w", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/u1", "", http.StatusNoContent)
+	if got := groupPaths(t, ds, "/v1/db/_group/comments"); len(got) != 2 || got[0] != "/v1/db/u2/comments/y" || got[1] != "/v1/db/u3/comments/w" {
+		t.Errorf("Group query after changes found %v", got)
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/missing/_group/comments", "", http.StatusNotFound)
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// labelsHeader sets the labels of a document written by PUT or POST, as a comma
+// separated list of key=value pairs such as "owner=team-a, tier=gold".
+const labelsHeader = "X-Labels"
+
+// errInvalidLabel is returned for a label with an empty key or a key containing one of
+// the separators used by the labels header and the label query parameter.
+var errInvalidLabel = errors.New("Label keys must be non-empty and must not contain ',', '=' or ':'")
+
+// A labelFilter selects the documents carrying a label with the given value.
+type labelFilter struct {
+	key   string
+	value string
+}
+
+// A metaRequest is the body of a PUT or PATCH on a document's _meta endpoint. In a PATCH,
+// a null value removes the label.
+type metaRequest struct {
+	Labels map[string]*string `json:"labels"`
+}
+
+// validLabelKey reports whether a label key can be written in a header or a query.
+func validLabelKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, ",=:")
+}
+
+// parseLabelsHeader reads the labels header of a write. The second return value is false
+// if the request does not set labels.
+func parseLabelsHeader(r *http.Request) (map[string]string, bool, error) {
+	values, ok := r.Header[labelsHeader]
+	if !ok {
+		return nil, false, nil
+	}
+	labels := make(map[string]string)
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, labelValue, found := strings.Cut(pair, "=")
+			key = strings.TrimSpace(key)
+			if !found || !validLabelKey(key) {
+				return nil, false, errInvalidLabel
+			}
+			labels[key] = strings.TrimSpace(labelValue)
+		}
+	}
+	return labels, true, nil
+}
+
+// parseLabelFilter reads a label query parameter of the form key:value.
+func parseLabelFilter(param string) (labelFilter, error) {
+	key, value, found := strings.Cut(param, ":")
+	if !found || !validLabelKey(key) {
+		return labelFilter{}, fmt.Errorf("invalid label filter %q", param)
+	}
+	return labelFilter{key: key, value: value}, nil
+}
+
+// matches reports whether the document carries the label.
+func (f labelFilter) matches(doc *Document) bool {
+	value, ok := doc.Metadata.Labels[f.key]
+	return ok && value == f.value
+}
+
+// HandleMeta answers requests on the _meta endpoint of a document. GET returns the
+// document's metadata, PUT replaces its labels and PATCH changes only the labels it names.
+// Changing labels writes a new version of the document, which is published to subscribers.
+func (ds *DatabaseService) HandleMeta(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	pathParts, err := splitPath(path)
+	if err != nil || len(pathParts)%2 == 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Metadata is only kept for documents\"")
+		return
+	}
+
+	var request metaRequest
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+			return
+		}
+		for key := range request.Labels {
+			if !validLabelKey(key) {
+				sendErrorResponse(w, http.StatusBadRequest, jsonString(errInvalidLabel.Error()))
+				return
+			}
+		}
+	}
+
+	// Lock the database.
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	item, exists := ds.findItem(pathParts)
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Document does not exist\"")
+		return
+	}
+	doc := item.(*Document)
+
+	if r.Method != http.MethodGet {
+		// Labels are replaced rather than modified in place, since readers may still hold
+		// the current version of the document.
+		labels := make(map[string]string)
+		if r.Method == http.MethodPatch {
+			maps.Copy(labels, doc.Metadata.Labels)
+		}
+		for key, value := range request.Labels {
+			if value == nil {
+				delete(labels, key)
+			} else {
+				labels[key] = *value
+			}
+		}
+
+		updated := *doc
+		updated.Metadata.Labels = labels
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		updated.Metadata.modified(user, time.Now())
+		parent, _ := ds.findItem(pathParts[:len(pathParts)-1])
+		err := parent.(*Collection).storeDocument(pathParts[len(pathParts)-1], &updated, ds.ownerCheck(pathParts, user))
+		if err == errNotOwner {
+			sendErrorResponse(w, http.StatusForbidden, jsonString(err.Error()))
+			return
+		}
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+		ds.notifyUpdate(pathParts, &updated)
+		doc = &updated
+	}
+
+	response, err := json.Marshal(doc.Metadata)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("ETag", doc.ETag())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
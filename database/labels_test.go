@@ -0,0 +1,80 @@
+package database
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// putLabeled writes a document with the labels header.
+func putLabeled(t *testing.T, ds *DatabaseService, path string, body string, labels string, want int) {
+	t.Helper()
+	r := newRequest("alice", http.MethodPut, path, body)
+	r.Header.Set(labelsHeader, labels)
+	if w := serve(ds, r); w.Code != want {
+		t.Fatalf("PUT %s with labels %q answered %d, want %d: %s", path, labels, w.Code, want, w.Body.String())
+	}
+}
+
+// labelsOf returns the labels of the document at the path.
+func labelsOf(t *testing.T, ds *DatabaseService, path string) map[string]any {
+	t.Helper()
+	labels, _ := documentMeta(t, ds, path)["labels"].(map[string]any)
+	return labels
+}
+
+func TestLabels(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	putLabeled(t, ds, "/v1/db/a", `{}`, "owner=team-a, tier=gold", http.StatusCreated)
+	putLabeled(t, ds, "/v1/db/b", `{}`, "owner=team-b", http.StatusCreated)
+	putLabeled(t, ds, "/v1/db/c", `{}`, "owner", http.StatusBadRequest)
+
+	// An overwrite without the header keeps the labels, and one with it replaces them.
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/a", `{"n":1}`, http.StatusOK)
+	if got := labelsOf(t, ds, "/v1/db/a"); !reflect.DeepEqual(got, map[string]any{"owner": "team-a", "tier": "gold"}) {
+		t.Errorf("Labels after an overwrite are %v", got)
+	}
+	putLabeled(t, ds, "/v1/db/b", `{}`, "owner=team-a", http.StatusOK)
+
+	var docs []map[string]any
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/?label=owner:team-a", "", http.StatusOK), &docs)
+	if len(docs) != 2 {
+		t.Errorf("Label query found %d documents, want 2", len(docs))
+	}
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/?label=owner:team-a&label=tier:gold", "", http.StatusOK), &docs)
+	if len(docs) != 1 || docs[0]["path"] != "/a" {
+		t.Errorf("Label query found %v, want only a", docs)
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/?label=owner", "", http.StatusBadRequest)
+}
+
+func TestMetaEndpoint(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	putLabeled(t, ds, "/v1/db/a", `{"n":1}`, "owner=team-a, tier=gold", http.StatusCreated)
+	etag := mustDo(t, ds, "alice", http.MethodGet, "/v1/db/a", "", http.StatusOK).Header().Get("ETag")
+
+	mustDo(t, ds, "bob", http.MethodPatch, "/v1/db/a/_meta", `{"labels":{"tier":null,"region":"eu"}}`, http.StatusOK)
+	if got := labelsOf(t, ds, "/v1/db/a"); !reflect.DeepEqual(got, map[string]any{"owner": "team-a", "region": "eu"}) {
+		t.Errorf("Labels after PATCH are %v", got)
+	}
+	meta := documentMeta(t, ds, "/v1/db/a")
+	if meta["lastModifiedBy"] != "bob" {
+		t.Errorf("Label change was attributed to %v", meta["lastModifiedBy"])
+	}
+	if got := mustDo(t, ds, "alice", http.MethodGet, "/v1/db/a", "", http.StatusOK).Header().Get("ETag"); got == etag {
+		t.Error("Changing labels kept the document's ETag")
+	}
+
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/a/_meta", `{"labels":{"tier":"silver"}}`, http.StatusOK)
+	if got := labelsOf(t, ds, "/v1/db/a"); !reflect.DeepEqual(got, map[string]any{"tier": "silver"}) {
+		t.Errorf("Labels after PUT are %v", got)
+	}
+	if got := documentData(t, ds, "alice", "/v1/db/a"); got["n"] != 1.0 {
+		t.Errorf("Label change modified the data to %v", got)
+	}
+
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/a/_meta", `{"labels":{"a=b":"c"}}`, http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/missing/_meta", "", http.StatusNotFound)
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonvisit"
+)
+
+// mergePatchMediaType is the Content-Type of a JSON Merge Patch request body.
+const mergePatchMediaType = "application/merge-patch+json"
+
+// applyMergePatch merges a JSON Merge Patch (RFC 7386) into target and returns the
+// result. Members of the patch that are null are deleted from the target. The target
+// is not modified; parts of it that the patch does not touch are shared with the result.
+func applyMergePatch(target any, patch any) (any, error) {
+	return jsonvisit.Accept[any](patch, mergeVisitor{target: target})
+}
+
+// mergeVisitor visits a merge patch and merges it into the target value.
+type mergeVisitor struct {
+	target any
+}
+
+func (v mergeVisitor) Map(patch map[string]any) (any, error) {
+	// Merging an object into anything but an object starts from an empty object.
+	result, err := jsonvisit.Accept[map[string]any](v.target, objectCopier{})
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range patch {
+		if value == nil {
+			delete(result, name)
+			continue
+		}
+		merged, err := jsonvisit.Accept[any](value, mergeVisitor{target: result[name]})
+		if err != nil {
+			return nil, err
+		}
+		result[name] = merged
+	}
+	return result, nil
+}
+
+// Any patch value other than an object replaces the target.
+func (v mergeVisitor) Slice(s []any) (any, error)     { return deepCopy(s) }
+func (v mergeVisitor) Bool(b bool) (any, error)       { return b, nil }
+func (v mergeVisitor) Float64(f float64) (any, error) { return f, nil }
+func (v mergeVisitor) String(s string) (any, error)   { return s, nil }
+func (v mergeVisitor) Null() (any, error)             { return nil, nil }
+
+// objectCopier returns a shallow copy of an object, or an empty object for any other value.
+type objectCopier struct{}
+
+func (objectCopier) Map(m map[string]any) (map[string]any, error) {
+	result := make(map[string]any, len(m))
+	for key, value := range m {
+		result[key] = value
+	}
+	return result, nil
+}
+
+func (objectCopier) Slice([]any) (map[string]any, error)     { return map[string]any{}, nil }
+func (objectCopier) Bool(bool) (map[string]any, error)       { return map[string]any{}, nil }
+func (objectCopier) Float64(float64) (map[string]any, error) { return map[string]any{}, nil }
+func (objectCopier) String(string) (map[string]any, error)   { return map[string]any{}, nil }
+func (objectCopier) Null() (map[string]any, error)           { return map[string]any{}, nil }
+
+// handleMergePatch merges a JSON Merge Patch request body into a document.
+// The caller must hold ds.mu.
+func (ds *DatabaseService) handleMergePatch(w http.ResponseWriter, r *http.Request, pathParts []string, c *Collection, target *Document, check precondition) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var patch any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+		return
+	}
+
+	data, err := applyMergePatch(target.Data, patch)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+
+	ds.commitPatch(w, r, pathParts, c, target, data, check)
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -10,6 +11,7 @@ type Metadata struct {
 	CreatedAt      time.Time
 	LastModifiedBy string
 	LastModifiedAt time.Time
+	Labels         map[string]string // Operational labels, replaced rather than modified
 }
 
 // NewMetadata creates and returns a new Metadata struct based on the inputs.
@@ -21,3 +23,42 @@ func NewMetadata(user string, time time.Time) *Metadata {
 		LastModifiedAt: time,
 	}
 }
+
+// modified records a write of the document by the user at the given time.
+func (m *Metadata) modified(user string, at time.Time) {
+	m.LastModifiedBy = user
+	m.LastModifiedAt = at
+}
+
+// keepCreation carries the creator and creation time of a replaced document over to the
+// document replacing it.
+func (m *Metadata) keepCreation(previous Metadata) {
+	m.CreatedBy = previous.CreatedBy
+	m.CreatedAt = previous.CreatedAt
+}
+
+// keepLabels carries the labels of a replaced document over to the document replacing
+// it, unless the write set labels of its own.
+func (m *Metadata) keepLabels(previous Metadata) {
+	if m.Labels == nil {
+		m.Labels = previous.Labels
+	}
+}
+
+// MarshalJSON encodes the metadata with camel case keys and times in milliseconds since
+// the Unix epoch.
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		CreatedBy      string            `json:"createdBy"`
+		CreatedAt      int64             `json:"createdAt"`
+		LastModifiedBy string            `json:"lastModifiedBy"`
+		LastModifiedAt int64             `json:"lastModifiedAt"`
+		Labels         map[string]string `json:"labels,omitempty"`
+	}{
+		CreatedBy:      m.CreatedBy,
+		CreatedAt:      m.CreatedAt.UnixMilli(),
+		LastModifiedBy: m.LastModifiedBy,
+		LastModifiedAt: m.LastModifiedAt.UnixMilli(),
+		Labels:         m.Labels,
+	})
+}
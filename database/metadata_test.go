@@ -0,0 +1,75 @@
+package database
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMetadataAttribution(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusCreated)
+	created := documentMeta(t, ds, "/v1/db/d")
+	if created["createdBy"] != "alice" || created["lastModifiedBy"] != "alice" {
+		t.Fatalf("New document has metadata %v", created)
+	}
+
+	// An overwrite keeps the creation metadata and records the writer.
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d", `{"n":2}`, http.StatusOK)
+	meta := documentMeta(t, ds, "/v1/db/d")
+	if meta["createdBy"] != "alice" || meta["createdAt"] != created["createdAt"] || meta["lastModifiedBy"] != "bob" {
+		t.Errorf("Overwritten document has metadata %v", meta)
+	}
+	if meta["lastModifiedAt"].(float64) < created["lastModifiedAt"].(float64) {
+		t.Errorf("Modification time went back from %v to %v", created["lastModifiedAt"], meta["lastModifiedAt"])
+	}
+
+	r := newRequest("root", http.MethodPatch, "/v1/db/d", `[{"op":"add","path":"/m","value":1}]`)
+	r.Header.Set("Content-Type", jsonPatchMediaType)
+	if w := serve(ds, r); w.Code != http.StatusOK {
+		t.Fatalf("PATCH failed with %d: %s", w.Code, w.Body.String())
+	}
+	if meta := documentMeta(t, ds, "/v1/db/d"); meta["createdBy"] != "alice" || meta["lastModifiedBy"] != "root" {
+		t.Errorf("Patched document has metadata %v", meta)
+	}
+
+	// A deleted and recreated document belongs to its new creator.
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/d", "", http.StatusNoContent)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	if meta := documentMeta(t, ds, "/v1/db/d"); meta["createdBy"] != "bob" {
+		t.Errorf("Recreated document has metadata %v", meta)
+	}
+}
+
+// TestDocumentVersion checks the versions reported for request paths, and that they can
+// be read while a GET holds the tree for reading.
+func TestDocumentVersion(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusCreated)
+	etag := mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":2}`, http.StatusOK).Header().Get("ETag")
+	version, err := strconv.ParseUint(strings.Trim(etag, `"`), 10, 64)
+	if err != nil {
+		t.Fatalf("Invalid ETag %q", etag)
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	tests := []struct {
+		path string
+		want uint64
+	}{
+		{"/v1/db/d", version},
+		{"/v1/db/d/_meta", version},
+		{"/v1/db/missing", 0},
+		{"/v1/db", 0},
+		{"/_acl", 0},
+	}
+	for _, test := range tests {
+		if got := ds.DocumentVersion(test.path); got != test.want {
+			t.Errorf("DocumentVersion(%q) = %d, want %d", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
+)
+
+// errNotOwner is returned when a write to a database with owner-only writes comes from a
+// user other than the document's creator.
+var errNotOwner = errors.New("Only the owner of the document may change it")
+
+// A writePolicy is the body of GET and PUT on the _policy endpoint of a database.
+type writePolicy struct {
+	OwnerOnlyWrites bool `json:"ownerOnlyWrites"`
+}
+
+// An ownerTransfer is the body of PUT on the _owner endpoint of a document.
+type ownerTransfer struct {
+	Owner string `json:"owner"`
+}
+
+// ownerCheck returns the precondition a write by the user to the document at pathParts
+// must meet: if its database only allows owners to write, an existing document must have
+// been created by the user. Admins of the document may override ownership, and nil is
+// returned if the user needs no check.
+func (ds *DatabaseService) ownerCheck(pathParts []string, user string) precondition {
+	database, exists := ds.collections.Find(pathParts[1])
+	if !exists || !database.ownerOnlyWrites.Load() || ds.IsAdmin(user, pathKey(pathParts)) {
+		return nil
+	}
+	return func(current *Document, exists bool) error {
+		if exists && current.Metadata.CreatedBy != user {
+			return errNotOwner
+		}
+		return nil
+	}
+}
+
+// collectionOwnerCheck returns errNotOwner if the database's write policy keeps the user
+// from deleting or replacing the collection c at pathParts, which may be the database
+// itself. With owner-only writes, the user must own the document holding the collection,
+// if any, and every document in it, at any depth, unless they are an admin of the
+// collection. The caller must hold ds.mu.
+func (ds *DatabaseService) collectionOwnerCheck(ctx context.Context, pathParts []string, c *Collection, user string) error {
+	check := ds.ownerCheck(pathParts, user)
+	if check == nil {
+		return nil
+	}
+	// A database is not held by a document.
+	if len(pathParts) > 2 {
+		if parent, exists := ds.findItem(pathParts[:len(pathParts)-1]); exists {
+			if err := check(parent.(*Document), true); err != nil {
+				return err
+			}
+		}
+	}
+
+	var checkErr error
+	visit := func(nested *Collection) {
+		if checkErr != nil {
+			return
+		}
+		nested.Documents.Scan(ctx, "", "", func(doc skiplist.Pair[string, *Document]) bool {
+			checkErr = check(doc.Value, true)
+			return checkErr == nil
+		})
+	}
+	visit(c)
+	if err := walkCollections(ctx, c, visit); err != nil {
+		return err
+	}
+	return checkErr
+}
+
+// HandlePolicy answers GET and PUT on the _policy endpoint of a database, which reads and
+// sets whether only the creator of a document may change or delete it. Only admins of the
+// database may change its policy.
+func (ds *DatabaseService) HandlePolicy(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	pathParts, err := splitPath(path)
+	if err != nil || len(pathParts) != 2 {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Write policies are only set on a database\"")
+		return
+	}
+	database, exists := ds.collections.Find(pathParts[1])
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Database does not exist\"")
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+		if !ds.IsAdmin(user, path) {
+			sendForbidden(w)
+			return
+		}
+		var policy writePolicy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+			return
+		}
+		database.ownerOnlyWrites.Store(policy.OwnerOnlyWrites)
+	}
+
+	response, err := json.Marshal(writePolicy{OwnerOnlyWrites: database.ownerOnlyWrites.Load()})
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// HandleOwner answers PUT on the _owner endpoint of a document, which transfers the
+// document to another user by making them its creator. Only admins of the document may
+// transfer it. The transfer writes a new version of the document, which is published to
+// subscribers.
+func (ds *DatabaseService) HandleOwner(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	pathParts, err := splitPath(path)
+	if err != nil || len(pathParts)%2 == 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Only documents have an owner\"")
+		return
+	}
+	user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+	if !ds.IsAdmin(user, path) {
+		sendForbidden(w)
+		return
+	}
+	var transfer ownerTransfer
+	if err := json.NewDecoder(r.Body).Decode(&transfer); err != nil || transfer.Owner == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "\"A transfer needs the new owner\"")
+		return
+	}
+
+	// Lock the database.
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	item, exists := ds.findItem(pathParts)
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Document does not exist\"")
+		return
+	}
+	parent, _ := ds.findItem(pathParts[:len(pathParts)-1])
+
+	// The document is replaced rather than modified in place, since readers may still
+	// hold the current version.
+	updated := *item.(*Document)
+	updated.Metadata.CreatedBy = transfer.Owner
+	updated.Metadata.modified(user, time.Now())
+	if err := parent.(*Collection).storeDocument(pathParts[len(pathParts)-1], &updated, nil); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	ds.notifyUpdate(pathParts, &updated)
+
+	response, err := json.Marshal(updated.Metadata)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("ETag", updated.ETag())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
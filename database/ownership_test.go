@@ -0,0 +1,104 @@
+package database
+
+import (
+	"net/http"
+	"testing"
+)
+
+// newOwnerOnlyService returns a service whose admin is root and whose database db only
+// allows owners to write. Alice owns the document d and its collection c, in which bob
+// owns the document x.
+func newOwnerOnlyService(t *testing.T) *DatabaseService {
+	t.Helper()
+	ds := newTestService(t)
+	ds.SetAdmins([]string{"root"})
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/", "", http.StatusCreated)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d/c/x", `{}`, http.StatusCreated)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/_policy", `{"ownerOnlyWrites":true}`, http.StatusOK)
+	return ds
+}
+
+func TestPolicyNeedsAdmin(t *testing.T) {
+	ds := newTestService(t)
+	ds.SetAdmins([]string{"root"})
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db", "", http.StatusCreated)
+
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/_policy", `{"ownerOnlyWrites":true}`, http.StatusForbidden)
+	var policy writePolicy
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/_policy", "", http.StatusOK), &policy)
+	if policy.OwnerOnlyWrites {
+		t.Fatal("A non-admin changed the write policy")
+	}
+
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/_policy", `{"ownerOnlyWrites":true}`, http.StatusOK)
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/_policy", "", http.StatusOK), &policy)
+	if !policy.OwnerOnlyWrites {
+		t.Error("The admin's write policy was not kept")
+	}
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/d/_policy", `{}`, http.StatusBadRequest)
+}
+
+func TestOwnerOnlyDocumentWrites(t *testing.T) {
+	ds := newOwnerOnlyService(t)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusForbidden)
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/db/d", "", http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/x", `{}`, http.StatusForbidden)
+
+	// Owners may write their own documents, anyone may create new ones, and admins may
+	// write any document.
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d/c/x", `{"n":1}`, http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/y", `{}`, http.StatusCreated)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/d/c/y", `{"n":2}`, http.StatusOK)
+	if created := documentMeta(t, ds, "/v1/db/d/c/y")["createdBy"]; created != "alice" {
+		t.Errorf("Admin write changed the owner to %v", created)
+	}
+}
+
+// TestOwnerOnlyCollectionWrites checks that deleting or replacing a collection needs
+// ownership of the document holding it and of every document in it.
+func TestOwnerOnlyCollectionWrites(t *testing.T) {
+	ds := newOwnerOnlyService(t)
+
+	// Alice owns d and c, but not bob's document x in it.
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/d/c/", "", http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/", "", http.StatusForbidden)
+	// Bob owns everything in c, but not the document d holding it.
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/db/d/c/", "", http.StatusForbidden)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d/c/x", "", http.StatusOK)
+
+	// Once x is hers, alice may replace and delete the collection.
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d/c/x/_owner", `{"owner":"alice"}`, http.StatusForbidden)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/d/c/x/_owner", `{"owner":"alice"}`, http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d/c/x", "", http.StatusNotFound)
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/d/c/", "", http.StatusNoContent)
+}
+
+func TestAdminDeletesAnyCollection(t *testing.T) {
+	ds := newOwnerOnlyService(t)
+	mustDo(t, ds, "root", http.MethodDelete, "/v1/db/d/c/", "", http.StatusNoContent)
+}
+
+func TestOwnerTransfer(t *testing.T) {
+	ds := newOwnerOnlyService(t)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/d/_owner", `{}`, http.StatusBadRequest)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/d/c/_owner", `{"owner":"bob"}`, http.StatusBadRequest)
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/missing/_owner", `{"owner":"bob"}`, http.StatusNotFound)
+
+	mustDo(t, ds, "root", http.MethodPut, "/v1/db/d/_owner", `{"owner":"bob"}`, http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusForbidden)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/d", `{}`, http.StatusOK)
+}
+
+// TestDatabaseDeleteNeedsAdmin checks that only admins of a database may delete it, even
+// if they own none of its documents, whatever its write policy.
+func TestDatabaseDeleteNeedsAdmin(t *testing.T) {
+	ds := newOwnerOnlyService(t)
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db", "", http.StatusForbidden)
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/db", "", http.StatusForbidden)
+	mustDo(t, ds, "bob", http.MethodGet, "/v1/db/d/c/x", "", http.StatusOK)
+	mustDo(t, ds, "root", http.MethodDelete, "/v1/db", "", http.StatusNoContent)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db", "", http.StatusNotFound)
+}
@@ -0,0 +1,375 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonvisit"
+)
+
+// A jsonPatchOp is one operation of a JSON Patch (RFC 6902) document.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// jsonPatchMediaType is the Content-Type of a JSON Patch request body.
+const jsonPatchMediaType = "application/json-patch+json"
+
+// errSchemaMismatch is returned when a patched document does not conform to the schema.
+var errSchemaMismatch = errors.New("Patched document does not conform to the schema")
+
+// errPatchTestFailed is returned when a test operation does not match.
+var errPatchTestFailed = errors.New("test operation failed")
+
+// applyJSONPatch applies the operations in order to a copy of data and returns the
+// result. The original data is never modified, so a failing operation leaves it intact.
+func applyJSONPatch(data any, ops []jsonPatchOp) (any, error) {
+	result, err := deepCopy(data)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		result, err = op.apply(result)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return result, nil
+}
+
+// handleJSONPatch applies a JSON Patch request body to a document. The patch is applied
+// to a copy of the document's data, and the result is only stored if every operation
+// succeeds. The caller must hold ds.mu.
+func (ds *DatabaseService) handleJSONPatch(w http.ResponseWriter, r *http.Request, pathParts []string, c *Collection, target *Document, check precondition) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var ops []jsonPatchOp
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+		return
+	}
+
+	data, err := applyJSONPatch(target.Data, ops)
+	if errors.Is(err, errPatchTestFailed) || errors.Is(err, errPointerNotFound) {
+		sendErrorResponse(w, http.StatusConflict, jsonString(err.Error()))
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+
+	ds.commitPatch(w, r, pathParts, c, target, data, check)
+}
+
+// commitPatch stores the patched data of a document and answers with its URI.
+// The caller must hold ds.mu.
+func (ds *DatabaseService) commitPatch(w http.ResponseWriter, r *http.Request, pathParts []string, c *Collection, target *Document, data any, check precondition) {
+	updated, err := ds.storePatch(r, pathParts, c, target, data, check)
+	if err == errSchemaMismatch {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+	if err == errPreconditionFailed {
+		sendErrorResponse(w, http.StatusPreconditionFailed, jsonString(err.Error()))
+		return
+	}
+	if err == errNotOwner {
+		sendErrorResponse(w, http.StatusForbidden, jsonString(err.Error()))
+		return
+	}
+	var rejected triggerRejection
+	if errors.As(err, &rejected) {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+
+	response, err := updated.MarshalURI()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("ETag", updated.ETag())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// storePatch runs the pre-write triggers on the patched data of a document and revalidates
+// it against the schema. If it conforms and the precondition holds, it stores it as a new
+// version of the document and notifies subscribers. The caller must hold ds.mu.
+func (ds *DatabaseService) storePatch(r *http.Request, pathParts []string, c *Collection, target *Document, data any, check precondition) (*Document, error) {
+	user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+	event := WriteEvent{Path: pathKey(pathParts), User: user, Data: data, Previous: target.Data}
+	if err := ds.beforeWrite(&event); err != nil {
+		return nil, err
+	}
+	data = event.Data
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if ds.schemaValidator.ValidateData(body) != nil {
+		return nil, errSchemaMismatch
+	}
+
+	// Documents are replaced rather than modified in place.
+	updated := *target
+	updated.Data = data
+	updated.Metadata.modified(user, time.Now())
+	if err := c.storeDocument(pathParts[len(pathParts)-1], &updated, check); err != nil {
+		return nil, err
+	}
+	ds.notifyUpdate(pathParts, &updated)
+	ds.afterWrite(event)
+	return &updated, nil
+}
+
+// apply performs a single operation on data, which the operation may modify.
+func (op jsonPatchOp) apply(data any) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("missing value")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = resolvePointer(data, from); err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			if value, err = deepCopy(value); err != nil {
+				return nil, err
+			}
+			break
+		}
+		// A value cannot be moved into one of its own children.
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("cannot move a value into itself")
+		}
+		if data, err = editPointer(data, from, removeEdit{}); err != nil {
+			return nil, err
+		}
+	case "remove":
+		return editPointer(data, path, removeEdit{})
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	switch op.Op {
+	case "replace":
+		return editPointer(data, path, replaceEdit{value: value})
+	case "test":
+		actual, err := resolvePointer(data, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonvisit.Equal(actual, value) {
+			return nil, errPatchTestFailed
+		}
+		return data, nil
+	default:
+		return editPointer(data, path, addEdit{value: value})
+	}
+}
+
+// A containerEdit changes the member of an object or array named by the last token of
+// a pointer, returning the changed container.
+type containerEdit interface {
+	editMap(m map[string]any, key string) (any, error)
+	editSlice(s []any, token string) (any, error)
+	editRoot(data any) (any, error)
+}
+
+// editPointer applies edit to the container that holds the value the pointer refers to,
+// and returns data with the changed container in place.
+func editPointer(data any, tokens []string, edit containerEdit) (any, error) {
+	if len(tokens) == 0 {
+		return edit.editRoot(data)
+	}
+	return jsonvisit.Accept[any](data, editVisitor{tokens: tokens, edit: edit})
+}
+
+// editVisitor walks to the parent of the value a pointer refers to and applies an edit.
+type editVisitor struct {
+	tokens []string
+	edit   containerEdit
+}
+
+func (v editVisitor) Map(m map[string]any) (any, error) {
+	if len(v.tokens) == 1 {
+		return v.edit.editMap(m, v.tokens[0])
+	}
+	child, ok := m[v.tokens[0]]
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	updated, err := jsonvisit.Accept[any](child, editVisitor{tokens: v.tokens[1:], edit: v.edit})
+	if err != nil {
+		return nil, err
+	}
+	m[v.tokens[0]] = updated
+	return m, nil
+}
+
+func (v editVisitor) Slice(s []any) (any, error) {
+	if len(v.tokens) == 1 {
+		return v.edit.editSlice(s, v.tokens[0])
+	}
+	index, ok := arrayIndex(v.tokens[0], len(s))
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	updated, err := jsonvisit.Accept[any](s[index], editVisitor{tokens: v.tokens[1:], edit: v.edit})
+	if err != nil {
+		return nil, err
+	}
+	s[index] = updated
+	return s, nil
+}
+
+// Scalars have no members to edit.
+func (v editVisitor) Bool(bool) (any, error)       { return nil, errPointerNotFound }
+func (v editVisitor) Float64(float64) (any, error) { return nil, errPointerNotFound }
+func (v editVisitor) String(string) (any, error)   { return nil, errPointerNotFound }
+func (v editVisitor) Null() (any, error)           { return nil, errPointerNotFound }
+
+// addEdit adds a member to an object, replacing any existing one, or inserts an element
+// into an array before the given index, or at the end for "-".
+type addEdit struct {
+	value any
+}
+
+func (e addEdit) editMap(m map[string]any, key string) (any, error) {
+	m[key] = e.value
+	return m, nil
+}
+
+func (e addEdit) editSlice(s []any, token string) (any, error) {
+	if token == "-" {
+		return append(s, e.value), nil
+	}
+	// Inserting at the index one past the end appends.
+	index, ok := arrayIndex(token, len(s)+1)
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	s = append(s, nil)
+	copy(s[index+1:], s[index:])
+	s[index] = e.value
+	return s, nil
+}
+
+func (e addEdit) editRoot(any) (any, error) {
+	return e.value, nil
+}
+
+// removeEdit removes an existing member of an object or element of an array.
+type removeEdit struct{}
+
+func (e removeEdit) editMap(m map[string]any, key string) (any, error) {
+	if _, ok := m[key]; !ok {
+		return nil, errPointerNotFound
+	}
+	delete(m, key)
+	return m, nil
+}
+
+func (e removeEdit) editSlice(s []any, token string) (any, error) {
+	index, ok := arrayIndex(token, len(s))
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	return append(s[:index], s[index+1:]...), nil
+}
+
+func (e removeEdit) editRoot(any) (any, error) {
+	return nil, fmt.Errorf("cannot remove the whole document")
+}
+
+// replaceEdit replaces an existing member of an object or element of an array.
+type replaceEdit struct {
+	value any
+}
+
+func (e replaceEdit) editMap(m map[string]any, key string) (any, error) {
+	if _, ok := m[key]; !ok {
+		return nil, errPointerNotFound
+	}
+	m[key] = e.value
+	return m, nil
+}
+
+func (e replaceEdit) editSlice(s []any, token string) (any, error) {
+	index, ok := arrayIndex(token, len(s))
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	s[index] = e.value
+	return s, nil
+}
+
+func (e replaceEdit) editRoot(any) (any, error) {
+	return e.value, nil
+}
+
+// deepCopy returns a copy of a JSON value that shares no objects or arrays with it.
+func deepCopy(value any) (any, error) {
+	return jsonvisit.Accept[any](value, copyVisitor{})
+}
+
+// copyVisitor rebuilds a JSON value with fresh objects and arrays.
+type copyVisitor struct{}
+
+func (c copyVisitor) Map(m map[string]any) (any, error) {
+	result := make(map[string]any, len(m))
+	for key, value := range m {
+		copied, err := jsonvisit.Accept[any](value, c)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = copied
+	}
+	return result, nil
+}
+
+func (c copyVisitor) Slice(s []any) (any, error) {
+	result := make([]any, len(s))
+	for i, value := range s {
+		copied, err := jsonvisit.Accept[any](value, c)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = copied
+	}
+	return result, nil
+}
+
+func (c copyVisitor) Bool(b bool) (any, error)       { return b, nil }
+func (c copyVisitor) Float64(f float64) (any, error) { return f, nil }
+func (c copyVisitor) String(s string) (any, error)   { return s, nil }
+func (c copyVisitor) Null() (any, error)             { return nil, nil }
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// mustJSON decodes a JSON literal, failing the test if it is invalid.
+func mustJSON(t *testing.T, literal string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(literal), &v); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", literal, err)
+	}
+	return v
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`},
+		{"insert element", `{"l":[1,3]}`, `[{"op":"add","path":"/l/1","value":2}]`, `{"l":[1,2,3]}`},
+		{"append with dash", `{"l":[1]}`, `[{"op":"add","path":"/l/-","value":2}]`, `{"l":[1,2]}`},
+		{"append at length", `{"l":[1]}`, `[{"op":"add","path":"/l/1","value":2}]`, `{"l":[1,2]}`},
+		{"remove element", `{"l":[1,2,3]}`, `[{"op":"remove","path":"/l/0"}]`, `{"l":[2,3]}`},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{"move", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`},
+		{"move to sibling with shared prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test passes", `{"a":[1,{"b":null}]}`, `[{"op":"test","path":"/a","value":[1,{"b":null}]}]`, `{"a":[1,{"b":null}]}`},
+		{"escaped tokens", `{}`, `[{"op":"add","path":"/a~1b","value":1},{"op":"add","path":"/c~0d","value":2}]`, `{"a/b":1,"c~d":2}`},
+	}
+	for _, test := range tests {
+		var ops []jsonPatchOp
+		if err := json.Unmarshal([]byte(test.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+		got, err := applyJSONPatch(mustJSON(t, test.doc), ops)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if want := mustJSON(t, test.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, patch string
+		want             error // Expected error, or nil for any error
+	}{
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, errPatchTestFailed},
+		{"remove missing member", `{}`, `[{"op":"remove","path":"/a"}]`, errPointerNotFound},
+		{"replace missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, errPointerNotFound},
+		{"add past the end", `{"l":[]}`, `[{"op":"add","path":"/l/1","value":1}]`, errPointerNotFound},
+		{"add under missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, errPointerNotFound},
+		{"move into own child", `{"a":{}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, nil},
+		{"unknown operation", `{}`, `[{"op":"merge","path":"/a"}]`, nil},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, nil},
+		{"pointer without slash", `{}`, `[{"op":"add","path":"a","value":1}]`, nil},
+	}
+	for _, test := range tests {
+		var ops []jsonPatchOp
+		if err := json.Unmarshal([]byte(test.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+		doc := mustJSON(t, test.doc)
+		_, err := applyJSONPatch(doc, ops)
+		if err == nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+		if !reflect.DeepEqual(doc, mustJSON(t, test.doc)) {
+			t.Errorf("%s: failed patch modified the document to %v", test.name, doc)
+		}
+	}
+}
+
+func TestJSONPatchRequest(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":1,"tags":[]}`, http.StatusCreated)
+
+	patch := func(body string, want int) {
+		t.Helper()
+		r := newRequest("alice", http.MethodPatch, "/v1/db/d", body)
+		r.Header.Set("Content-Type", jsonPatchMediaType)
+		if w := serve(ds, r); w.Code != want {
+			t.Fatalf("PATCH %s answered %d, want %d: %s", body, w.Code, want, w.Body.String())
+		}
+	}
+	patch(`[{"op":"test","path":"/n","value":1},{"op":"replace","path":"/n","value":2},{"op":"add","path":"/tags/-","value":"x"}]`, http.StatusOK)
+	patch(`[{"op":"replace","path":"/n","value":3},{"op":"test","path":"/n","value":1}]`, http.StatusConflict)
+	patch(`[{"op":"copy","from":"/missing","path":"/n"}]`, http.StatusConflict)
+	patch(`[{"op":"frobnicate","path":"/n"}]`, http.StatusBadRequest)
+	patch(`{"op":"add"}`, http.StatusBadRequest)
+
+	if got := documentData(t, ds, "alice", "/v1/db/d"); !reflect.DeepEqual(got, map[string]any{"n": 2.0, "tags": []any{"x"}}) {
+		t.Errorf("Document is %v after the patches", got)
+	}
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonvisit"
+)
+
+// A patchOperation is one OwlDB patch operation. ArrayAdd adds a value to the array at
+// the path unless an equal value is already there, ArrayRemove removes every value equal
+// to the given one from the array at the path, and ObjectAdd adds the member named by
+// the last token of the path unless the object already has it.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// A patchResult reports the outcome of one patch operation.
+type patchResult struct {
+	URI         string `json:"uri"`
+	PatchFailed bool   `json:"patchFailed"`
+	Message     string `json:"message"`
+}
+
+// apply performs the operation on data, which it may modify.
+func (op patchOperation) apply(data any) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(op.Value) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	var value any
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "ArrayAdd":
+		return editPointer(data, path, transformEdit{visitor: arrayAddVisitor{value: value}})
+	case "ArrayRemove":
+		return editPointer(data, path, transformEdit{visitor: arrayRemoveVisitor{value: value}})
+	case "ObjectAdd":
+		return editPointer(data, path, objectAddEdit{value: value})
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// transformEdit replaces the value a pointer refers to with the result of visiting it.
+type transformEdit struct {
+	visitor jsonvisit.Visitor[any]
+}
+
+func (e transformEdit) editMap(m map[string]any, key string) (any, error) {
+	child, ok := m[key]
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	updated, err := jsonvisit.Accept[any](child, e.visitor)
+	if err != nil {
+		return nil, err
+	}
+	m[key] = updated
+	return m, nil
+}
+
+func (e transformEdit) editSlice(s []any, token string) (any, error) {
+	index, ok := arrayIndex(token, len(s))
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	updated, err := jsonvisit.Accept[any](s[index], e.visitor)
+	if err != nil {
+		return nil, err
+	}
+	s[index] = updated
+	return s, nil
+}
+
+func (e transformEdit) editRoot(data any) (any, error) {
+	return jsonvisit.Accept[any](data, e.visitor)
+}
+
+// notArray is the error of array operations applied to any other value.
+type notArray struct{}
+
+func (notArray) Map(map[string]any) (any, error) { return nil, fmt.Errorf("path is not an array") }
+func (notArray) Bool(bool) (any, error)          { return nil, fmt.Errorf("path is not an array") }
+func (notArray) Float64(float64) (any, error)    { return nil, fmt.Errorf("path is not an array") }
+func (notArray) String(string) (any, error)      { return nil, fmt.Errorf("path is not an array") }
+func (notArray) Null() (any, error)              { return nil, fmt.Errorf("path is not an array") }
+
+// arrayAddVisitor appends a value to an array that does not already contain it.
+type arrayAddVisitor struct {
+	notArray
+	value any
+}
+
+func (v arrayAddVisitor) Slice(s []any) (any, error) {
+	for _, element := range s {
+		if jsonvisit.Equal(element, v.value) {
+			return s, nil
+		}
+	}
+	return append(s, v.value), nil
+}
+
+// arrayRemoveVisitor removes every element equal to a value from an array.
+type arrayRemoveVisitor struct {
+	notArray
+	value any
+}
+
+func (v arrayRemoveVisitor) Slice(s []any) (any, error) {
+	kept := s[:0]
+	for _, element := range s {
+		if !jsonvisit.Equal(element, v.value) {
+			kept = append(kept, element)
+		}
+	}
+	return kept, nil
+}
+
+// objectAddEdit adds a member to an object that does not already have it.
+type objectAddEdit struct {
+	value any
+}
+
+func (e objectAddEdit) editMap(m map[string]any, key string) (any, error) {
+	if _, exists := m[key]; !exists {
+		m[key] = e.value
+	}
+	return m, nil
+}
+
+func (e objectAddEdit) editSlice([]any, string) (any, error) {
+	return nil, fmt.Errorf("path is not in an object")
+}
+
+func (e objectAddEdit) editRoot(any) (any, error) {
+	return nil, fmt.Errorf("path is not in an object")
+}
+
+// handleOperationPatch applies a list of OwlDB patch operations to a document and
+// reports the outcome of each one. The operations are applied all or nothing: if one
+// fails, the document is left unchanged, every operation is reported as failed and the
+// response has an error status. The caller must hold ds.mu.
+func (ds *DatabaseService) handleOperationPatch(w http.ResponseWriter, r *http.Request, pathParts []string, c *Collection, target *Document, check precondition) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var ops []patchOperation
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+		return
+	}
+
+	results := make([]patchResult, len(ops))
+	for i := range results {
+		results[i] = patchResult{URI: target.URI, Message: "patch applied"}
+	}
+
+	// Apply the operations to a copy so that a failure leaves the document unchanged.
+	data, err := deepCopy(target.Data)
+	failed := -1
+	for i := 0; err == nil && i < len(ops); i++ {
+		if data, err = ops[i].apply(data); err != nil {
+			failed = i
+		}
+	}
+	var updated *Document
+	if err == nil {
+		updated, err = ds.storePatch(r, pathParts, c, target, data, check)
+	}
+	if err == errPreconditionFailed {
+		sendErrorResponse(w, http.StatusPreconditionFailed, jsonString(err.Error()))
+		return
+	}
+	if err == errNotOwner {
+		sendErrorResponse(w, http.StatusForbidden, jsonString(err.Error()))
+		return
+	}
+	if updated != nil {
+		w.Header().Set("ETag", updated.ETag())
+	}
+
+	// A rejected patch is reported by its status as well as by its results, so that clients
+	// which only check the status do not mistake it for success.
+	status := http.StatusOK
+	var rejected triggerRejection
+	switch {
+	case err == nil:
+	case failed != -1:
+		status = http.StatusConflict
+	case err == errSchemaMismatch || errors.As(err, &rejected):
+		status = http.StatusBadRequest
+	default:
+		status = http.StatusInternalServerError
+	}
+
+	if err != nil {
+		for i := range results {
+			results[i].PatchFailed = true
+			switch {
+			case i == failed:
+				results[i].Message = err.Error()
+			case failed == -1:
+				results[i].Message = "not applied: " + err.Error()
+			default:
+				results[i].Message = fmt.Sprintf("not applied: operation %d failed", failed)
+			}
+		}
+	}
+
+	response, err := json.Marshal(results)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestOperationPatch(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"tags":["a"],"info":{}}`, http.StatusCreated)
+
+	var results []patchResult
+	decode(t, mustDo(t, ds, "alice", http.MethodPatch, "/v1/db/d", `[
+		{"op":"ArrayAdd","path":"/tags","value":"b"},
+		{"op":"ArrayAdd","path":"/tags","value":"a"},
+		{"op":"ObjectAdd","path":"/info/x","value":1}
+	]`, http.StatusOK), &results)
+	for i, result := range results {
+		if result.PatchFailed {
+			t.Errorf("Operation %d failed: %s", i, result.Message)
+		}
+	}
+	want := map[string]any{"tags": []any{"a", "b"}, "info": map[string]any{"x": 1.0}}
+	if got := documentData(t, ds, "alice", "/v1/db/d"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Patched document is %v, want %v", got, want)
+	}
+}
+
+func TestOperationPatchFailureIsAllOrNothing(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"tags":["a"],"n":1}`, http.StatusCreated)
+
+	var results []patchResult
+	decode(t, mustDo(t, ds, "alice", http.MethodPatch, "/v1/db/d", `[
+		{"op":"ArrayRemove","path":"/tags","value":"a"},
+		{"op":"ArrayAdd","path":"/n","value":2}
+	]`, http.StatusConflict), &results)
+	if len(results) != 2 || !results[0].PatchFailed || !results[1].PatchFailed {
+		t.Fatalf("Expected both operations to be reported as failed, got %v", results)
+	}
+
+	want := map[string]any{"tags": []any{"a"}, "n": 1.0}
+	if got := documentData(t, ds, "alice", "/v1/db/d"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Rejected patch changed the document to %v", got)
+	}
+}
@@ -38,3 +38,29 @@ func splitPath(path string) ([]string, error) {
 	// The returned slice removes the leading and trailing slashes and decodes any percent-encoded values.
 	return parts, nil
 }
+
+// splitAction separates a trailing action segment such as "_aggregate" from the path.
+// Action segments start with an underscore. If the path has none, action is empty.
+func splitAction(path string) (base string, action string) {
+	trimmedPath := strings.TrimSuffix(path, "/")
+	i := strings.LastIndex(trimmedPath, "/")
+	if i == -1 || !strings.HasPrefix(trimmedPath[i+1:], "_") {
+		return path, ""
+	}
+	return trimmedPath[:i], trimmedPath[i+1:]
+}
+
+// splitGroupPath recognizes a collection group path of the form /v1/{db}/_group/{name}
+// and returns the database and collection names.
+func splitGroupPath(path string) (database string, name string, ok bool) {
+	pathParts, err := splitPath(path)
+	if err != nil || len(pathParts) != 4 || pathParts[2] != "_group" {
+		return "", "", false
+	}
+	return pathParts[1], pathParts[3], true
+}
+
+// pathKey joins split path parts back into a canonical path, without a trailing slash.
+func pathKey(pathParts []string) string {
+	return "/" + strings.Join(pathParts, "/")
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonvisit"
+)
+
+// errPointerNotFound is returned when a JSON Pointer does not resolve to a value.
+var errPointerNotFound = errors.New("pointer does not resolve to a value")
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+// The empty pointer refers to the whole document and yields no tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		// ~1 must be replaced before ~0 so that "~01" becomes "~1" and not "/".
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex converts a reference token into an index into an array of the given length.
+func arrayIndex(token string, length int) (int, bool) {
+	// Leading zeros and signs are not allowed by RFC 6901.
+	if token == "" || (len(token) > 1 && token[0] == '0') || token[0] == '+' || token[0] == '-' {
+		return 0, false
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index >= length {
+		return 0, false
+	}
+	return index, true
+}
+
+// pointerVisitor walks a JSON value along the reference tokens of a JSON Pointer
+// and returns the value the pointer refers to.
+type pointerVisitor struct {
+	tokens []string
+}
+
+// resolvePointer returns the value inside data that the given tokens refer to,
+// or errPointerNotFound if the pointer does not resolve.
+func resolvePointer(data any, tokens []string) (any, error) {
+	return jsonvisit.Accept[any](data, pointerVisitor{tokens: tokens})
+}
+
+func (v pointerVisitor) Map(m map[string]any) (any, error) {
+	if len(v.tokens) == 0 {
+		return m, nil
+	}
+	child, ok := m[v.tokens[0]]
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	return jsonvisit.Accept[any](child, pointerVisitor{tokens: v.tokens[1:]})
+}
+
+func (v pointerVisitor) Slice(s []any) (any, error) {
+	if len(v.tokens) == 0 {
+		return s, nil
+	}
+	index, ok := arrayIndex(v.tokens[0], len(s))
+	if !ok {
+		return nil, errPointerNotFound
+	}
+	return jsonvisit.Accept[any](s[index], pointerVisitor{tokens: v.tokens[1:]})
+}
+
+func (v pointerVisitor) Bool(b bool) (any, error) {
+	return v.leaf(b)
+}
+
+func (v pointerVisitor) Float64(f float64) (any, error) {
+	return v.leaf(f)
+}
+
+func (v pointerVisitor) String(s string) (any, error) {
+	return v.leaf(s)
+}
+
+func (v pointerVisitor) Null() (any, error) {
+	return v.leaf(nil)
+}
+
+// leaf returns a scalar value if the pointer ends here. Scalars have no children.
+func (v pointerVisitor) leaf(value any) (any, error) {
+	if len(v.tokens) != 0 {
+		return nil, errPointerNotFound
+	}
+	return value, nil
+}
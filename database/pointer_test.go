@@ -0,0 +1,68 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestResolvePointer(t *testing.T) {
+	var data any
+	if err := json.Unmarshal([]byte(`{"a/b":1,"m~n":2,"list":[{"x":3},4],"":5,"nested":{"k":null}}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pointer string
+		want    any
+	}{
+		{"", data},
+		{"/a~1b", 1.0},
+		{"/m~0n", 2.0},
+		{"/list/0/x", 3.0},
+		{"/list/1", 4.0},
+		{"/", 5.0},
+		{"/nested/k", nil},
+	}
+	for _, test := range tests {
+		tokens, err := parsePointer(test.pointer)
+		if err != nil {
+			t.Fatalf("parsePointer(%q): %v", test.pointer, err)
+		}
+		got, err := resolvePointer(data, tokens)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Pointer %q resolved to %v, %v, want %v", test.pointer, got, err, test.want)
+		}
+	}
+
+	for _, pointer := range []string{"/missing", "/list/2", "/list/01", "/list/-", "/list/-1", "/list/0/x/y", "/nested/k/z"} {
+		tokens, _ := parsePointer(pointer)
+		if _, err := resolvePointer(data, tokens); !errors.Is(err, errPointerNotFound) {
+			t.Errorf("Pointer %q returned %v, want errPointerNotFound", pointer, err)
+		}
+	}
+	if _, err := parsePointer("a/b"); err == nil {
+		t.Error("Pointer without a leading slash was accepted")
+	}
+}
+
+func TestPointerRead(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"tags":["a","b"],"owner":{"name":"alice"}}`, http.StatusCreated)
+
+	var value any
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d?pointer="+url.QueryEscape("/owner/name"), "", http.StatusOK), &value)
+	if value != "alice" {
+		t.Errorf("Pointer read returned %v, want alice", value)
+	}
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d?pointer="+url.QueryEscape("/tags"), "", http.StatusOK), &value)
+	if !reflect.DeepEqual(value, []any{"a", "b"}) {
+		t.Errorf("Pointer read returned %v, want the tags", value)
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d?pointer="+url.QueryEscape("/tags/2"), "", http.StatusNotFound)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d?pointer=tags", "", http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/?pointer="+url.QueryEscape("/tags"), "", http.StatusBadRequest)
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonvisit"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
+)
+
+// A collectionQuery selects the documents of a collection whose names fall in a key
+// interval, whose contents match every filter and which carry every label.
+type collectionQuery struct {
+	start   string // First document name in the interval, "" for no lower bound
+	end     string // Last document name in the interval, "" for no upper bound
+	filters []filter
+	labels  []labelFilter
+	stats   *queryStats // Execution statistics, only collected when the query is explained
+}
+
+// queryStats records how much work a query did, for the explain plan.
+type queryStats struct {
+	scanned    int
+	returned   int
+	filterTime time.Duration
+}
+
+// A filter compares the value at a JSON Pointer inside a document with a constant.
+type filter struct {
+	raw     string
+	pointer []string
+	op      string
+	value   any
+}
+
+// Comparison operators accepted in a where clause. Two character operators come
+// first so that "<=" is not read as "<" followed by "=".
+var filterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseCollectionQuery reads the interval, where and label parameters of a collection
+// request. The interval has the form [start,end] where either bound may be empty, each
+// where clause has the form <pointer><op><value>, for example /age>=21, and each label
+// has the form <key>:<value>, for example owner:team-a.
+func parseCollectionQuery(values url.Values) (*collectionQuery, error) {
+	q := &collectionQuery{}
+
+	if interval := values.Get("interval"); interval != "" {
+		if !strings.HasPrefix(interval, "[") || !strings.HasSuffix(interval, "]") {
+			return nil, fmt.Errorf("invalid interval %q", interval)
+		}
+		start, end, found := strings.Cut(interval[1:len(interval)-1], ",")
+		if !found {
+			return nil, fmt.Errorf("invalid interval %q", interval)
+		}
+		q.start = start
+		q.end = end
+	}
+
+	for _, clause := range values["where"] {
+		f, err := parseFilter(clause)
+		if err != nil {
+			return nil, err
+		}
+		q.filters = append(q.filters, f)
+	}
+
+	for _, param := range values["label"] {
+		f, err := parseLabelFilter(param)
+		if err != nil {
+			return nil, err
+		}
+		q.labels = append(q.labels, f)
+	}
+
+	if values.Get("explain") == "true" {
+		q.stats = &queryStats{}
+	}
+	return q, nil
+}
+
+// parseFilter parses a single where clause.
+func parseFilter(clause string) (filter, error) {
+	// Find the earliest operator in the clause.
+	opIndex := -1
+	var op string
+	for _, candidate := range filterOps {
+		i := strings.Index(clause, candidate)
+		if i != -1 && (opIndex == -1 || i < opIndex) {
+			opIndex = i
+			op = candidate
+		}
+	}
+	if opIndex == -1 {
+		return filter{}, fmt.Errorf("invalid where clause %q: missing operator", clause)
+	}
+
+	pointer, err := parsePointer(clause[:opIndex])
+	if err != nil {
+		return filter{}, err
+	}
+
+	// The value is JSON, but a bare word is accepted as a string for convenience.
+	rawValue := clause[opIndex+len(op):]
+	var value any
+	if err := json.Unmarshal([]byte(rawValue), &value); err != nil {
+		value = rawValue
+	}
+
+	return filter{raw: clause, pointer: pointer, op: op, value: value}, nil
+}
+
+// matches reports whether the value at the filter's pointer satisfies the comparison.
+// Documents where the pointer does not resolve never match.
+func (f filter) matches(data any) bool {
+	actual, err := resolvePointer(data, f.pointer)
+	if err != nil {
+		return false
+	}
+	switch f.op {
+	case "==":
+		return jsonvisit.Equal(actual, f.value)
+	case "!=":
+		return !jsonvisit.Equal(actual, f.value)
+	}
+	order, ok := compareJSON(actual, f.value)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// contains reports whether a document name falls inside the query's interval.
+func (q *collectionQuery) contains(name string) bool {
+	return (q.start == "" || name >= q.start) && (q.end == "" || name <= q.end)
+}
+
+// matches reports whether a document carries every label and satisfies every filter of
+// the query. Labels are checked first since they are cheaper.
+func (q *collectionQuery) matches(doc *Document) bool {
+	for _, f := range q.labels {
+		if !f.matches(doc) {
+			return false
+		}
+	}
+	for _, f := range q.filters {
+		if !f.matches(doc.Data) {
+			return false
+		}
+	}
+	return true
+}
+
+// accept applies the filters to a scanned document, recording statistics if the query is explained.
+func (q *collectionQuery) accept(doc *Document) bool {
+	if q.stats == nil {
+		return q.matches(doc)
+	}
+	start := time.Now()
+	ok := q.matches(doc)
+	q.stats.filterTime += time.Since(start)
+	q.stats.scanned++
+	if ok {
+		q.stats.returned++
+	}
+	return ok
+}
+
+// run streams the documents of the collection selected by the query to visit, in key order.
+// It stops early when visit returns false or the context is done.
+func (q *collectionQuery) run(ctx context.Context, c *Collection, visit func(*Document) bool) error {
+	return c.Documents.Scan(ctx, q.start, q.end, func(pair skiplist.Pair[string, *Document]) bool {
+		if !q.accept(pair.Value) {
+			return true
+		}
+		return visit(pair.Value)
+	})
+}
+
+// scalar is an orderable view of a JSON value produced by scalarVisitor.
+type scalar struct {
+	kind string
+	num  float64
+	str  string
+}
+
+// scalarVisitor classifies a JSON value so that numbers and strings can be ordered.
+type scalarVisitor struct{}
+
+func (scalarVisitor) Map(map[string]any) (scalar, error) { return scalar{kind: "object"}, nil }
+func (scalarVisitor) Slice([]any) (scalar, error)        { return scalar{kind: "array"}, nil }
+func (scalarVisitor) Bool(bool) (scalar, error)          { return scalar{kind: "bool"}, nil }
+func (scalarVisitor) Null() (scalar, error)              { return scalar{kind: "null"}, nil }
+
+func (scalarVisitor) Float64(f float64) (scalar, error) {
+	return scalar{kind: "number", num: f}, nil
+}
+
+func (scalarVisitor) String(s string) (scalar, error) {
+	return scalar{kind: "string", str: s}, nil
+}
+
+// compareJSON orders two JSON values. Only two numbers or two strings are ordered;
+// for any other combination ok is false.
+func compareJSON(a, b any) (order int, ok bool) {
+	x, err := jsonvisit.Accept[scalar](a, scalarVisitor{})
+	if err != nil {
+		return 0, false
+	}
+	y, err := jsonvisit.Accept[scalar](b, scalarVisitor{})
+	if err != nil || x.kind != y.kind {
+		return 0, false
+	}
+	switch x.kind {
+	case "number":
+		return cmp.Compare(x.num, y.num), true
+	case "string":
+		return cmp.Compare(x.str, y.str), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
+)
+
+// A relocateRequest is the body of a copy or move request.
+type relocateRequest struct {
+	Destination      string `json:"destination"`      // Full path of the new document, such as /v1/db/doc
+	PreserveMetadata bool   `json:"preserveMetadata"` // Keep the creation and modification metadata of the copies
+	Overwrite        bool   `json:"overwrite"`        // Replace a document that exists at the destination
+}
+
+// A subtreeCloner copies a document together with every collection and document nested
+// under it.
+type subtreeCloner struct {
+	ds       *DatabaseService
+	database string // Database of the destination, whose registry learns the new collections
+	user     string
+	now      time.Time
+	preserve bool
+}
+
+// cloneDocument returns a copy of doc stored at uri, with copies of its collections. The
+// copy shares no data with the original.
+func (cl *subtreeCloner) cloneDocument(ctx context.Context, doc *Document, name string, uri string) (*Document, error) {
+	data, err := deepCopy(doc.Data)
+	if err != nil {
+		return nil, err
+	}
+	clone := NewDocument("/"+name, data, cl.user, cl.now, uri)
+	// Labels are never modified in place, so the copy can share them.
+	clone.Metadata.Labels = doc.Metadata.Labels
+	if cl.preserve {
+		clone.Metadata = doc.Metadata
+	}
+
+	var cloneErr error
+	err = doc.Collections.Scan(ctx, "", "", func(pair skiplist.Pair[string, *Collection]) bool {
+		var c *Collection
+		c, cloneErr = cl.cloneCollection(ctx, pair.Value, uri+"/"+pair.Key+"/")
+		if cloneErr != nil {
+			return false
+		}
+		clone.Collections.Upsert(pair.Key, GenerateUpdateCheck[string, *Collection](c))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clone, cloneErr
+}
+
+// cloneCollection returns a copy of the collection stored at uri, with copies of its documents.
+func (cl *subtreeCloner) cloneCollection(ctx context.Context, c *Collection, uri string) (*Collection, error) {
+	clone := NewCollection(c.Name, cl.user, cl.now, uri)
+	if cl.preserve {
+		clone.meta = c.metadata()
+	}
+	if c.search != nil {
+		clone.search = c.search.emptyCopy()
+	}
+
+	var cloneErr error
+	err := c.Documents.Scan(ctx, "", "", func(pair skiplist.Pair[string, *Document]) bool {
+		var doc *Document
+		doc, cloneErr = cl.cloneDocument(ctx, pair.Value, pair.Key, strings.TrimSuffix(uri, "/")+"/"+pair.Key)
+		if cloneErr != nil {
+			return false
+		}
+		cloneErr = clone.storeDocument(pair.Key, doc, nil)
+		return cloneErr == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cloneErr != nil {
+		return nil, cloneErr
+	}
+	cl.ds.registerCollection(cl.database, clone)
+	return clone, nil
+}
+
+// HandleRelocate answers POST .../_copy and POST .../_move on a document. The document is
+// copied, together with everything nested under it, to the destination path; a move then
+// deletes the original. The database lock is held throughout, so other writers see either
+// the state before or after the whole operation.
+func (ds *DatabaseService) HandleRelocate(w http.ResponseWriter, r *http.Request, path string, move bool) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	source, err := splitPath(path)
+	if err != nil || len(source)%2 == 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Only documents can be copied or moved\"")
+		return
+	}
+	var request relocateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+		return
+	}
+	destination, err := splitPath(request.Destination)
+	if err != nil || len(destination)%2 == 0 || destination[0] != source[0] {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Destination must be a document path\"")
+		return
+	}
+	sourceKey, destinationKey := pathKey(source), pathKey(destination)
+	// The caller's role on the source was checked before dispatch.
+	user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+	if !ds.allowed(user, destinationKey, roleWriter) {
+		sendForbidden(w)
+		return
+	}
+	if destinationKey == sourceKey || strings.HasPrefix(destinationKey, sourceKey+"/") {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Cannot copy or move a document into itself\"")
+		return
+	}
+
+	// Lock the database.
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	item, exists := ds.findItem(source)
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Document does not exist\"")
+		return
+	}
+	doc := item.(*Document)
+	// Moving a document deletes it, which needs the same ownership as a DELETE.
+	if owner := ds.ownerCheck(source, user); move && owner != nil && owner(doc, true) != nil {
+		sendErrorResponse(w, http.StatusForbidden, jsonString(errNotOwner.Error()))
+		return
+	}
+	parent, exists := ds.findItem(destination[:len(destination)-1])
+	if !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Destination collection does not exist\"")
+		return
+	}
+	target := parent.(*Collection)
+
+	name := destination[len(destination)-1]
+	data, err := deepCopy(doc.Data)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	written := WriteEvent{Path: destinationKey, User: user, Data: data}
+	if previous, exists := target.Documents.Find(name); exists {
+		written.Previous = previous.Data
+	}
+	if err := ds.beforeWrite(&written); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+		return
+	}
+	deleted := WriteEvent{Path: sourceKey, User: user, Previous: doc.Data, Delete: true}
+	if move {
+		if err := ds.beforeWrite(&deleted); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+	}
+
+	cloner := &subtreeCloner{ds: ds, database: destination[1], user: user, now: time.Now(), preserve: request.PreserveMetadata}
+	clone, err := cloner.cloneDocument(r.Context(), doc, name, destinationKey)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	// Only the relocated document itself passes through the triggers, not its subtree.
+	clone.Data = written.Data
+
+	var overwritten *Document
+	check := allOf(ds.ownerCheck(destination, user), func(current *Document, exists bool) error {
+		if exists && !request.Overwrite {
+			return errPreconditionFailed
+		}
+		overwritten = current
+		return nil
+	})
+	err = target.storeDocument(name, clone, check)
+	if errors.Is(err, errPreconditionFailed) {
+		sendErrorResponse(w, http.StatusConflict, "\"Destination document already exists\"")
+		return
+	}
+	if errors.Is(err, errNotOwner) {
+		sendErrorResponse(w, http.StatusForbidden, jsonString(err.Error()))
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	// Subscribers beneath the destination see the overwritten subtree deleted, and then
+	// every relocated document created; those beneath a moved source see it deleted.
+	if overwritten != nil {
+		ds.notifyCollectionsDelete(r.Context(), destination, overwritten)
+	}
+	ds.notifyUpdate(destination, clone)
+	ds.notifySubtreeUpdate(r.Context(), destination, clone)
+	ds.afterWrite(written)
+
+	if move {
+		sourceParent, _ := ds.findItem(source[:len(source)-1])
+		sourceParent.(*Collection).removeDocument(source[len(source)-1], user)
+		ds.notifyDelete(source)
+		ds.afterWrite(deleted)
+	}
+
+	response, err := clone.MarshalURI()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("ETag", clone.ETag())
+	w.Header().Set("Content-Type", "application/json")
+	if overwritten != nil {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	w.Write(response)
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newSubtreeService returns a service whose database db holds the document src, created
+// by bob, with a collection c holding the document x.
+func newSubtreeService(t *testing.T) *DatabaseService {
+	t.Helper()
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/src", `{"n":1}`, http.StatusCreated)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/src/c/", "", http.StatusCreated)
+	mustDo(t, ds, "bob", http.MethodPut, "/v1/db/src/c/x", `{"v":"x"}`, http.StatusCreated)
+	return ds
+}
+
+func TestCopySubtree(t *testing.T) {
+	ds := newSubtreeService(t)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/dst"}`, http.StatusCreated)
+
+	if got := documentData(t, ds, "alice", "/v1/db/dst/c/x"); got["v"] != "x" {
+		t.Fatalf("Copied nested document holds %v", got)
+	}
+	if created := documentMeta(t, ds, "/v1/db/dst")["createdBy"]; created != "alice" {
+		t.Errorf("Copy was created by %v, want the copying user", created)
+	}
+
+	// The copy shares nothing with the original.
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/dst/c/x", `{"v":"changed"}`, http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/dst/c/y", `{}`, http.StatusCreated)
+	if got := documentData(t, ds, "alice", "/v1/db/src/c/x"); got["v"] != "x" {
+		t.Errorf("Changing the copy changed the original to %v", got)
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/src/c/y", "", http.StatusNotFound)
+
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/kept","preserveMetadata":true}`, http.StatusCreated)
+	if created := documentMeta(t, ds, "/v1/db/kept/c/x")["createdBy"]; created != "bob" {
+		t.Errorf("Copy with preserved metadata was created by %v, want bob", created)
+	}
+}
+
+func TestCopyOverwrite(t *testing.T) {
+	ds := newSubtreeService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/dst", `{"old":true}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/dst"}`, http.StatusConflict)
+	if got := documentData(t, ds, "alice", "/v1/db/dst"); got["old"] != true {
+		t.Fatalf("Refused copy changed the destination to %v", got)
+	}
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/dst","overwrite":true}`, http.StatusOK)
+	if got := documentData(t, ds, "alice", "/v1/db/dst"); got["n"] != 1.0 {
+		t.Errorf("Overwritten destination holds %v", got)
+	}
+}
+
+func TestMoveSubtree(t *testing.T) {
+	ds := newSubtreeService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/other", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/other/c/", "", http.StatusCreated)
+
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_move", `{"destination":"/v1/db/other/c/moved"}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/src", "", http.StatusNotFound)
+	if got := documentData(t, ds, "alice", "/v1/db/other/c/moved/c/x"); got["v"] != "x" {
+		t.Errorf("Moved nested document holds %v", got)
+	}
+}
+
+func TestRelocateErrors(t *testing.T) {
+	ds := newSubtreeService(t)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_move", `{"destination":"/v1/db/src/c/inside"}`, http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/src"}`, http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/src/c/"}`, http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/missing/_copy", `{"destination":"/v1/db/dst"}`, http.StatusNotFound)
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/nowhere/c/dst"}`, http.StatusNotFound)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/src/c/x", "", http.StatusOK)
+}
+
+// TestRelocateNotifiesSubtree checks that subscribers beneath the destination hear of the
+// documents relocated there and of the subtree an overwrite replaced, and that those
+// beneath a moved source hear of its deletion.
+func TestRelocateNotifiesSubtree(t *testing.T) {
+	ds := newSubtreeService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/dst", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/dst/old/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/dst/old/y", `{}`, http.StatusCreated)
+
+	replaced := ds.subs.subscribe("/v1/db/dst/old/y")
+	copied := ds.subs.subscribe("/v1/db/dst/c/x")
+	collection := ds.subs.subscribe("/v1/db/dst/c")
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_copy", `{"destination":"/v1/db/dst","overwrite":true}`, http.StatusOK)
+	if evt := nextEvent(t, replaced); evt.name != "delete" || evt.data != `"/v1/db/dst/old"` {
+		t.Errorf("Subscriber of the overwritten subtree got %v, want the deletion of /v1/db/dst/old", evt)
+	}
+	for _, sub := range []*subscriber{copied, collection} {
+		if evt := nextEvent(t, sub); evt.name != "update" || !strings.Contains(evt.data, `"v":"x"`) {
+			t.Errorf("Subscriber of the copied subtree got %v, want the copy of x", evt)
+		}
+		expectNoEvent(t, sub)
+	}
+
+	source := ds.subs.subscribe("/v1/db/src/c/x")
+	moved := ds.subs.subscribe("/v1/db/moved/c/x")
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/src/_move", `{"destination":"/v1/db/moved"}`, http.StatusCreated)
+	if evt := nextEvent(t, source); evt.name != "delete" || evt.data != `"/v1/db/src"` {
+		t.Errorf("Subscriber of the moved source got %v, want the deletion of /v1/db/src", evt)
+	}
+	if evt := nextEvent(t, moved); evt.name != "update" {
+		t.Errorf("Subscriber of the moved subtree got %v, want an update", evt)
+	}
+}
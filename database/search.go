@@ -0,0 +1,293 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonvisit"
+)
+
+// errNoSearchIndex is returned when a search is requested on a collection without an index.
+var errNoSearchIndex = errors.New("Collection has no search index")
+
+// A searchIndex is an inverted index from stemmed terms to the documents of a collection
+// that contain them. It indexes every string leaf of a document, or only the string
+// leaves found under the configured JSON Pointers.
+type searchIndex struct {
+	mu       sync.RWMutex
+	pointers [][]string                // Indexed pointers, nil for every string leaf
+	postings map[string]map[string]int // Term to document name to term frequency
+	terms    map[string]map[string]int // Document name to its term frequencies, used on removal
+}
+
+// A searchHit is one ranked result of a full-text search.
+type searchHit struct {
+	Path  string  `json:"path"`
+	Score float64 `json:"score"`
+}
+
+// newSearchIndex creates an index from the value of the searchindex parameter, which is
+// either "all" or a comma separated list of JSON Pointers.
+func newSearchIndex(config string) (*searchIndex, error) {
+	index := &searchIndex{
+		postings: make(map[string]map[string]int),
+		terms:    make(map[string]map[string]int),
+	}
+	if config == "all" {
+		return index, nil
+	}
+	for _, pointer := range strings.Split(config, ",") {
+		tokens, err := parsePointer(pointer)
+		if err != nil {
+			return nil, err
+		}
+		index.pointers = append(index.pointers, tokens)
+	}
+	return index, nil
+}
+
+// emptyCopy returns an index with the same configuration and no documents.
+func (index *searchIndex) emptyCopy() *searchIndex {
+	return &searchIndex{
+		pointers: index.pointers,
+		postings: make(map[string]map[string]int),
+		terms:    make(map[string]map[string]int),
+	}
+}
+
+// configureSearch gives a new collection a full-text index if the request that creates it
+// has a searchindex parameter.
+func configureSearch(c *Collection, values url.Values) error {
+	config, ok := values["searchindex"]
+	if !ok {
+		return nil
+	}
+	index, err := newSearchIndex(config[0])
+	if err != nil {
+		return err
+	}
+	c.search = index
+	return nil
+}
+
+// add indexes the data of the named document, replacing any earlier entry for it.
+func (index *searchIndex) add(name string, data any) {
+	var leaves []string
+	if index.pointers == nil {
+		leaves, _ = jsonvisit.Accept[[]string](data, stringCollector{})
+	} else {
+		for _, pointer := range index.pointers {
+			value, err := resolvePointer(data, pointer)
+			if err != nil {
+				continue
+			}
+			found, _ := jsonvisit.Accept[[]string](value, stringCollector{})
+			leaves = append(leaves, found...)
+		}
+	}
+
+	frequencies := make(map[string]int)
+	for _, leaf := range leaves {
+		for _, term := range tokenize(leaf) {
+			frequencies[term]++
+		}
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.removeLocked(name)
+	for term, count := range frequencies {
+		if index.postings[term] == nil {
+			index.postings[term] = make(map[string]int)
+		}
+		index.postings[term][name] = count
+	}
+	index.terms[name] = frequencies
+}
+
+// remove drops the named document from the index.
+func (index *searchIndex) remove(name string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.removeLocked(name)
+}
+
+// removeLocked drops the named document from the index. The caller must hold index.mu.
+func (index *searchIndex) removeLocked(name string) {
+	for term := range index.terms[name] {
+		delete(index.postings[term], name)
+		if len(index.postings[term]) == 0 {
+			delete(index.postings, term)
+		}
+	}
+	delete(index.terms, name)
+}
+
+// search ranks the documents containing any of the terms of the query by TF-IDF,
+// highest score first. Only documents accepted by keep are ranked.
+func (index *searchIndex) search(query string, keep func(name string) bool) []searchHit {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	total := float64(len(index.terms))
+	scores := make(map[string]float64)
+	for _, term := range tokenize(query) {
+		postings := index.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + total/float64(len(postings)))
+		for name, frequency := range postings {
+			scores[name] += float64(frequency) * idf
+		}
+	}
+
+	hits := []searchHit{}
+	for name, score := range scores {
+		if keep(name) {
+			hits = append(hits, searchHit{Path: "/" + name, Score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Path < hits[j].Path
+	})
+	return hits
+}
+
+// estimate returns an upper bound on the number of documents a search has to examine.
+func (index *searchIndex) estimate(query string) int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	estimate := 0
+	for _, term := range tokenize(query) {
+		estimate += len(index.postings[term])
+	}
+	return min(estimate, len(index.terms))
+}
+
+// tokenize splits text into lowercase, stemmed terms on every character that is not a
+// letter or a digit.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = stem(word)
+	}
+	return words
+}
+
+// Suffixes removed by stem, with their replacements. The plural rules of step 1a of the
+// Porter stemmer come first, so that "names" and "name" or "likes" and "like" share a
+// term; a trailing "ss" as in "class" is kept.
+var stemSuffixes = []struct{ suffix, replacement string }{
+	{"sses", "ss"},
+	{"ies", "i"},
+	{"ss", "ss"},
+	{"s", ""},
+	{"ing", ""},
+	{"ed", ""},
+	{"ly", ""},
+}
+
+// stem strips a common English suffix so that related word forms share a term. It is a
+// deliberately small subset of the Porter stemmer.
+func stem(word string) string {
+	// Work on runes, since words may contain letters outside ASCII.
+	stemmed := []rune(word)
+	for _, rule := range stemSuffixes {
+		if !strings.HasSuffix(word, rule.suffix) {
+			continue
+		}
+		stemmed = []rune(strings.TrimSuffix(word, rule.suffix) + rule.replacement)
+		// Keep short words intact so that "is" or "bed" are not mangled.
+		if len(stemmed) < 3 {
+			return word
+		}
+		// Undouble the final consonant left by "-ing" and "-ed", as in "running".
+		n := len(stemmed)
+		if (rule.suffix == "ing" || rule.suffix == "ed") && stemmed[n-1] == stemmed[n-2] &&
+			!strings.ContainsRune("aeioulsz", stemmed[n-1]) {
+			stemmed = stemmed[:n-1]
+		}
+		break
+	}
+	// A final "y" after a vowel-bearing stem becomes "i", as in step 1c, so that "pony"
+	// matches the "poni" left of "ponies".
+	if n := len(stemmed); n > 1 && stemmed[n-1] == 'y' && strings.ContainsAny(string(stemmed[:n-1]), "aeiou") {
+		stemmed[n-1] = 'i'
+	}
+	return string(stemmed)
+}
+
+// stringCollector gathers every string leaf of a JSON value.
+type stringCollector struct{}
+
+func (c stringCollector) Map(m map[string]any) ([]string, error) {
+	var leaves []string
+	for _, value := range m {
+		found, err := jsonvisit.Accept[[]string](value, c)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, found...)
+	}
+	return leaves, nil
+}
+
+func (c stringCollector) Slice(s []any) ([]string, error) {
+	var leaves []string
+	for _, value := range s {
+		found, err := jsonvisit.Accept[[]string](value, c)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, found...)
+	}
+	return leaves, nil
+}
+
+func (c stringCollector) Bool(bool) ([]string, error)       { return nil, nil }
+func (c stringCollector) Float64(float64) ([]string, error) { return nil, nil }
+func (c stringCollector) Null() ([]string, error)           { return nil, nil }
+
+func (c stringCollector) String(s string) ([]string, error) {
+	return []string{s}, nil
+}
+
+// searchCollection runs a full-text search over the collection. Hits are limited to the
+// documents selected by the query's interval and filters.
+func searchCollection(c *Collection, text string, query *collectionQuery) []searchHit {
+	return c.search.search(text, func(name string) bool {
+		doc, exists := c.Documents.Find(name)
+		return exists && query.contains(name) && query.accept(doc)
+	})
+}
+
+// writeSearchResults answers a collection GET with a search parameter.
+func writeSearchResults(w http.ResponseWriter, c *Collection, text string, query *collectionQuery) {
+	if c.search == nil {
+		sendErrorResponse(w, http.StatusBadRequest, jsonString(errNoSearchIndex.Error()))
+		return
+	}
+
+	response, err := json.Marshal(searchCollection(c, text, query))
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
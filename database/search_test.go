@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"running": "run",
+		"classes": "class",
+		"class":   "class",
+		"ponies":  "poni",
+		"pony":    "poni",
+		"bed":     "bed",
+		"falling": "fall",
+		"names":   "name",
+		"name":    "name",
+		"likes":   "like",
+		"like":    "like",
+		// The last two bytes of 丸 are equal, but it is a single rune.
+		"ab丸ing": "ab丸",
+		"ab丸丸ed": "ab丸",
+	}
+	for word, want := range tests {
+		got := stem(word)
+		if got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("stem(%q) = %q is not valid UTF-8", word, got)
+		}
+	}
+}
+
+func TestSearchIndexFindsStemmedTerms(t *testing.T) {
+	index, err := newSearchIndex("/title")
+	if err != nil {
+		t.Fatalf("newSearchIndex: %v", err)
+	}
+	index.add("a", map[string]any{"title": "Running shoes"})
+	index.add("b", map[string]any{"title": "A run in the park"})
+	index.add("c", map[string]any{"title": "Swimming"})
+
+	hits := index.search("runs", func(string) bool { return true })
+	if len(hits) != 2 {
+		t.Fatalf("Expected 2 hits for \"runs\", got %v", hits)
+	}
+	index.remove("a")
+	hits = index.search("runs", func(string) bool { return true })
+	if len(hits) != 1 || hits[0].Path != "/b" {
+		t.Fatalf("Expected only b after removing a, got %v", hits)
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/authorization"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonschema"
+)
+
+// TestMain silences the request logging of the handlers under test.
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testUsers are the users of newTestService. Each user's token is "token-" and its name.
+var testUsers = []string{"alice", "bob", "root"}
+
+// newTestService returns a database service without a schema whose token store holds the
+// tokens of testUsers.
+func newTestService(t *testing.T, triggers ...TriggerRegistration) *DatabaseService {
+	t.Helper()
+	auth := authorization.NewAuth()
+	t.Cleanup(auth.Close)
+
+	tokens := make(map[string]string)
+	for _, user := range testUsers {
+		tokens[user] = "token-" + user
+	}
+	dat, err := json.Marshal(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, dat, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.LoadTokenFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	validator, err := jsonschema.NewSchemaValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDatabaseService(auth, validator, triggers...)
+}
+
+// newRequest returns a request from the user.
+func newRequest(user string, method string, path string, body string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer token-"+user)
+	return r
+}
+
+// serve sends a request to the service and returns the recorded response.
+func serve(ds *DatabaseService, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ds.DBMethods(w, r)
+	return w
+}
+
+// do sends a request from the user to the service and returns the recorded response.
+func do(t *testing.T, ds *DatabaseService, user string, method string, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(ds, newRequest(user, method, path, body))
+}
+
+// mustDo sends a request like do and fails the test unless it has the wanted status.
+func mustDo(t *testing.T, ds *DatabaseService, user string, method string, path string, body string, want int) *httptest.ResponseRecorder {
+	t.Helper()
+	w := do(t, ds, user, method, path, body)
+	if w.Code != want {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, w.Code, want, w.Body.String())
+	}
+	return w
+}
+
+// decode unmarshals a response body into v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+	}
+}
+
+// documentData returns the contents of the document at path, as read by the user.
+func documentData(t *testing.T, ds *DatabaseService, user string, path string) map[string]any {
+	t.Helper()
+	var doc struct {
+		Doc map[string]any `json:"doc"`
+	}
+	decode(t, mustDo(t, ds, user, http.MethodGet, path, "", http.StatusOK), &doc)
+	return doc.Doc
+}
+
+// documentMeta returns the metadata of the document at the path, read by root.
+func documentMeta(t *testing.T, ds *DatabaseService, path string) map[string]any {
+	t.Helper()
+	var doc struct {
+		Meta map[string]any `json:"meta"`
+	}
+	decode(t, mustDo(t, ds, "root", http.MethodGet, path, "", http.StatusOK), &doc)
+	return doc.Meta
+}
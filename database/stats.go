@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
+)
+
+// statCounts are the live counters of a collection, or their sum over a database.
+type statCounts struct {
+	Documents   int64 `json:"documents"`
+	Collections int64 `json:"collections"`
+	Bytes       int64 `json:"bytes"`
+}
+
+// collectionStats is the response to GET with mode=stats on a collection or database.
+// Total is only reported for a database, and sums the counters of every collection in it.
+type collectionStats struct {
+	URI      string   `json:"uri"`
+	Metadata Metadata `json:"meta"`
+	statCounts
+	Total *statCounts `json:"total,omitempty"`
+}
+
+// dataBytes returns the size of a document's data encoded as JSON.
+func dataBytes(data any) int64 {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return 0
+	}
+	return int64(len(body))
+}
+
+// countCollections returns the number of collections held by a document.
+func countCollections(doc *Document) int64 {
+	var count int64
+	doc.Collections.Scan(context.TODO(), "", "", func(skiplist.Pair[string, *Collection]) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// modified records a write to the collection by the user at the given time.
+func (c *Collection) modified(user string, at time.Time) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	c.meta.modified(user, at)
+}
+
+// metadata returns a copy of the collection's metadata.
+func (c *Collection) metadata() Metadata {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	return c.meta
+}
+
+// counts returns the current counters of the collection.
+func (c *Collection) counts() statCounts {
+	return statCounts{
+		Documents:   c.size.Load(),
+		Collections: c.subcollections.Load(),
+		Bytes:       c.bytes.Load(),
+	}
+}
+
+// collectionAdded records that a collection was created in, or removed from (with a
+// negative delta), a document of the collection at pathParts[:len(pathParts)-2]. The
+// caller must hold ds.mu.
+func (ds *DatabaseService) collectionAdded(pathParts []string, delta int64) {
+	if parent, exists := ds.findItem(pathParts[:len(pathParts)-2]); exists {
+		parent.(*Collection).subcollections.Add(delta)
+	}
+}
+
+// collectionRemoved records that the collection c at pathParts was deleted, or replaced
+// if replaced is true. A replaced collection keeps its place in the parent's count, but
+// in both cases c and the collections nested under it leave the database. The caller
+// must hold ds.mu.
+func (ds *DatabaseService) collectionRemoved(pathParts []string, c *Collection, replaced bool) {
+	if !replaced {
+		ds.collectionAdded(pathParts, -1)
+	}
+	ds.unregisterCollection(pathParts[1], c)
+}
+
+// writeStats answers GET with mode=stats on a collection. A database also reports the
+// totals of every collection nested in it.
+func writeStats(w http.ResponseWriter, r *http.Request, c *Collection, isDatabase bool) {
+	stats := collectionStats{
+		URI:        c.URI,
+		Metadata:   c.metadata(),
+		statCounts: c.counts(),
+	}
+	if isDatabase {
+		total := stats.statCounts
+		err := walkCollections(r.Context(), c, func(nested *Collection) {
+			counts := nested.counts()
+			total.Documents += counts.Documents
+			total.Collections += counts.Collections
+			total.Bytes += counts.Bytes
+		})
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+		stats.Total = &total
+	}
+
+	response, err := json.Marshal(stats)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
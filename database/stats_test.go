@@ -0,0 +1,62 @@
+package database
+
+import (
+	"net/http"
+	"testing"
+)
+
+// databaseTotal returns the totals reported by GET with mode=stats on the database.
+func databaseTotal(t *testing.T, ds *DatabaseService, path string) statCounts {
+	t.Helper()
+	var stats struct {
+		Total *statCounts `json:"total"`
+	}
+	decode(t, mustDo(t, ds, "alice", http.MethodGet, path+"?mode=stats", "", http.StatusOK), &stats)
+	if stats.Total == nil {
+		t.Fatalf("Expected totals for database %s", path)
+	}
+	return *stats.Total
+}
+
+// registered returns the number of collections with the name in the database's registry.
+func registered(ds *DatabaseService, databaseName string, name string) int {
+	database, _ := ds.collections.Find(databaseName)
+	return len(database.registry.byName[name])
+}
+
+// TestReplacedCollectionLeavesDatabase checks that the stats and the collection registry
+// forget a collection, and everything under it, once it is replaced or deleted.
+func TestReplacedCollectionLeavesDatabase(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/x", `{"n":1}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/x/inner/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/x/inner/y", `{}`, http.StatusCreated)
+
+	// Build the registry.
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/_group/inner", "", http.StatusOK)
+	if n := registered(ds, "db", "inner"); n != 1 {
+		t.Fatalf("Expected 1 registered inner collection, got %d", n)
+	}
+	if got, want := databaseTotal(t, ds, "/v1/db"), (statCounts{Documents: 3, Collections: 2, Bytes: 11}); got != want {
+		t.Errorf("Totals are %+v, want %+v", got, want)
+	}
+
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/", "", http.StatusCreated)
+	if got, want := databaseTotal(t, ds, "/v1/db"), (statCounts{Documents: 1, Collections: 1, Bytes: 2}); got != want {
+		t.Errorf("Totals after replacing the collection are %+v, want %+v", got, want)
+	}
+	if n, c := registered(ds, "db", "inner"), registered(ds, "db", "c"); n != 0 || c != 1 {
+		t.Errorf("Registry holds %d inner and %d c collections after the replace, want 0 and 1", n, c)
+	}
+
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/d/c/", "", http.StatusNoContent)
+	if got, want := databaseTotal(t, ds, "/v1/db"), (statCounts{Documents: 1, Bytes: 2}); got != want {
+		t.Errorf("Totals after deleting the collection are %+v, want %+v", got, want)
+	}
+	if c := registered(ds, "db", "c"); c != 0 {
+		t.Errorf("Registry holds %d c collections after the delete, want 0", c)
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
+)
+
+// streamFlushInterval is the number of records written between flushes of a streamed
+// response.
+const streamFlushInterval = 64
+
+// streamChunkSize is the number of documents a stream scans at a time while holding
+// ds.mu for reading. The lock is released before each chunk is written to the client.
+const streamChunkSize = 64
+
+// writeCollectionStream writes the documents selected by the query as a JSON array or, if
+// the client accepts application/x-ndjson, as one document per line. The collection is
+// read in chunks of streamChunkSize documents under ds.mu, and the lock is released while
+// each chunk is written, so a slow client does not hold off writers. The first chunk is
+// read under the lock held by the caller, which is released by calling release. Stored
+// documents are never changed, so the documents of a chunk may be encoded without the
+// lock, but documents written while the stream runs may or may not be included. The scan
+// stops as soon as the client disconnects.
+func (ds *DatabaseService) writeCollectionStream(w http.ResponseWriter, r *http.Request, c *Collection, query *collectionQuery, release func()) {
+	docs, last, more, err := query.runChunk(r.Context(), c, "", streamChunkSize)
+	release()
+
+	ndjson := strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+	flusher, canFlush := w.(http.Flusher)
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	if !ndjson {
+		w.Write([]byte("["))
+	}
+	written := 0
+	var writeErr error
+	for err == nil && writeErr == nil {
+		for _, doc := range docs {
+			if !ndjson && written > 0 {
+				if _, writeErr = w.Write([]byte(",")); writeErr != nil {
+					break
+				}
+			}
+			// Encode ends each document with a newline, which also separates NDJSON records.
+			if writeErr = encoder.Encode(doc); writeErr != nil {
+				break
+			}
+			written++
+		}
+		if writeErr != nil || !more {
+			break
+		}
+		if canFlush {
+			flusher.Flush()
+		}
+
+		ds.mu.RLock()
+		docs, last, more, err = query.runChunk(r.Context(), c, last, streamChunkSize)
+		ds.mu.RUnlock()
+	}
+	if err != nil || writeErr != nil {
+		// The status has already been sent, so the client sees a truncated stream.
+		slog.Info("Collection stream stopped", "path", r.URL.Path, "error", err, "writeError", writeErr)
+		return
+	}
+
+	if !ndjson {
+		w.Write([]byte("]"))
+	}
+	if canFlush {
+		flusher.Flush()
+	}
+}
+
+// runChunk scans up to limit documents of the collection in the query's interval whose
+// names come after the given one, or from the start of the interval if it is "". It
+// returns the documents selected by the query, the name of the last document scanned, and
+// whether the interval may hold more documents. The caller must hold ds.mu for reading.
+func (q *collectionQuery) runChunk(ctx context.Context, c *Collection, after string, limit int) ([]*Document, string, bool, error) {
+	start := q.start
+	if after > start {
+		start = after
+	}
+	var docs []*Document
+	scanned := 0
+	last := after
+	err := c.Documents.Scan(ctx, start, q.end, func(pair skiplist.Pair[string, *Document]) bool {
+		if after != "" && pair.Key == after {
+			return true
+		}
+		if q.accept(pair.Value) {
+			docs = append(docs, pair.Value)
+		}
+		scanned++
+		last = pair.Key
+		return scanned < limit
+	})
+	return docs, last, scanned == limit, err
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStreamNDJSON(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	for i := 0; i < 3; i++ {
+		mustDo(t, ds, "alice", http.MethodPut, fmt.Sprintf("/v1/db/d%d", i), fmt.Sprintf(`{"n":%d}`, i), http.StatusCreated)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/db/", nil)
+	r.Header.Set("Authorization", "Bearer token-alice")
+	r.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	ds.DBMethods(w, r)
+
+	if got := w.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Fatalf("Expected NDJSON, got %q", got)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var doc map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("Invalid record %q: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Errorf("Expected 3 records, got %d", lines)
+	}
+}
+
+// TestStreamDuringWrites reads collections while their documents are replaced. Run with
+// -race to check that streams do not read documents as they are written.
+func TestStreamDuringWrites(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			do(t, ds, "alice", http.MethodPut, fmt.Sprintf("/v1/db/d%d", i%10), fmt.Sprintf(`{"n":%d}`, i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			w := do(t, ds, "bob", http.MethodGet, "/v1/db/", "")
+			var docs []map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &docs); err != nil {
+				t.Errorf("Invalid stream %q: %v", strings.TrimSpace(w.Body.String()), err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+// TestStreamChunks checks that a stream spanning several chunks returns each selected
+// document once, in order.
+func TestStreamChunks(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	const docs = 3*streamChunkSize + 5
+	for i := 0; i < docs; i++ {
+		mustDo(t, ds, "alice", http.MethodPut, fmt.Sprintf("/v1/db/d%03d", i), fmt.Sprintf(`{"n":%d}`, i), http.StatusCreated)
+	}
+
+	var all []struct {
+		Path string `json:"path"`
+	}
+	decode(t, mustDo(t, ds, "bob", http.MethodGet, "/v1/db/", "", http.StatusOK), &all)
+	if len(all) != docs {
+		t.Fatalf("Expected %d documents, got %d", docs, len(all))
+	}
+	for i, doc := range all {
+		if want := fmt.Sprintf("/d%03d", i); doc.Path != want {
+			t.Fatalf("Document %d is %s, want %s", i, doc.Path, want)
+		}
+	}
+
+	var odd []map[string]any
+	path := "/v1/db/?interval=[d010,d150]&where=/n>=100"
+	decode(t, mustDo(t, ds, "bob", http.MethodGet, path, "", http.StatusOK), &odd)
+	if len(odd) != 51 {
+		t.Errorf("Expected 51 documents from the filtered interval, got %d", len(odd))
+	}
+}
+
+// A stalledWriter blocks every write to the response until unblock is closed.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{} // Closed on the first write
+	unblock chan struct{}
+	once    sync.Once
+}
+
+func (w *stalledWriter) Write(b []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.unblock
+	return w.ResponseRecorder.Write(b)
+}
+
+// TestStalledStreamDoesNotBlockWriters checks that a client which stops reading a stream
+// does not hold the lock writers need.
+func TestStalledStreamDoesNotBlockWriters(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/a", `{}`, http.StatusCreated)
+
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder(), writing: make(chan struct{}), unblock: make(chan struct{})}
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+		ds.DBMethods(w, newRequest("bob", http.MethodGet, "/v1/db/", ""))
+	}()
+	<-w.writing
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		do(t, ds, "alice", http.MethodPut, "/v1/db/b", `{}`)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Error("Write was blocked by a stalled stream")
+	}
+	close(w.unblock)
+	<-streamed
+	<-written
+}
@@ -2,24 +2,96 @@ package database
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/skiplist"
 )
 
+// subHandler keeps track of the clients subscribed to documents and collections and
+// delivers change events to them as server-sent events.
 type subHandler struct {
-	mu sync.Mutex
+	mu          sync.Mutex
+	subscribers map[string]map[*subscriber]struct{} // Subscribed path to its subscribers
+}
+
+// A subscriber receives the events published on the path it subscribed to.
+type subscriber struct {
+	events chan subEvent
 }
 
+// A subEvent is one server-sent event.
+type subEvent struct {
+	name string
+	data string
+}
+
+// subscriberBuffer is the number of events a subscriber may fall behind by before it
+// starts missing events.
+const subscriberBuffer = 64
+
 type writeFlusher interface {
 	http.ResponseWriter
 	http.Flusher
 }
 
 func NewSubHandler() *subHandler {
-	return &subHandler{}
+	return &subHandler{subscribers: make(map[string]map[*subscriber]struct{})}
+}
+
+// subscribe registers a new subscriber for the path.
+func (s *subHandler) subscribe(path string) *subscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := &subscriber{events: make(chan subEvent, subscriberBuffer)}
+	if s.subscribers[path] == nil {
+		s.subscribers[path] = make(map[*subscriber]struct{})
+	}
+	s.subscribers[path][sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe removes a subscriber from the path.
+func (s *subHandler) unsubscribe(path string, sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers[path], sub)
+	if len(s.subscribers[path]) == 0 {
+		delete(s.subscribers, path)
+	}
+}
+
+// publish sends an event to the subscribers of each of the given paths. A subscriber that
+// is not keeping up misses the event rather than blocking the writer.
+func (s *subHandler) publish(event string, data string, paths ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range paths {
+		for sub := range s.subscribers[path] {
+			select {
+			case sub.events <- subEvent{name: event, data: data}:
+			default:
+				slog.Info("Subscriber is behind, dropping event", "path", path, "event", event)
+			}
+		}
+	}
+}
+
+// publishTree sends an event to the subscribers of the path and of every path beneath it.
+func (s *subHandler) publishTree(event string, data string, path string) {
+	s.mu.Lock()
+	var paths []string
+	for subscribed := range s.subscribers {
+		if covers(path, subscribed) {
+			paths = append(paths, subscribed)
+		}
+	}
+	s.mu.Unlock()
+	s.publish(event, data, paths...)
 }
 
 func (s *subHandler) send(wf writeFlusher, event string, data string) {
@@ -27,12 +99,10 @@ func (s *subHandler) send(wf writeFlusher, event string, data string) {
 	var evt bytes.Buffer
 
 	if event == "comment" {
-		evt.WriteString("")
+		evt.WriteString(": keepalive\n\n")
 	} else {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		id := fmt.Sprint(time.Now().UnixMilli())
-		evt.WriteString(fmt.Sprintf("event: " + event + "\ndata: " + data + "\nid: " + id))
+		evt.WriteString("event: " + event + "\ndata: " + data + "\nid: " + id + "\n\n")
 	}
 
 	slog.Info("Sending", "msg", evt.String())
@@ -42,7 +112,9 @@ func (s *subHandler) send(wf writeFlusher, event string, data string) {
 	wf.Flush()
 }
 
-func (s *subHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// serve streams the initial events and then every event published to the subscriber
+// until the client closes the connection.
+func (s *subHandler) serve(w http.ResponseWriter, r *http.Request, sub *subscriber, initial []subEvent) {
 	wf, ok := w.(writeFlusher)
 	if !ok {
 		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
@@ -57,12 +129,15 @@ func (s *subHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	wf.Header().Set("Connection", "keep-alive")
 	wf.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID")
 	wf.Header().Set("Access-Control-Allow-Origin", "*")
-	wf.Header().Set("Authorization", "Bearer")
 	wf.WriteHeader(http.StatusOK)
 	wf.Flush()
 
 	slog.Info("Event stream successfully setup")
 
+	for _, evt := range initial {
+		s.send(wf, evt.name, evt.data)
+	}
+
 	for {
 		select {
 		case <-r.Context().Done():
@@ -70,40 +145,96 @@ func (s *subHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			slog.Info("Client closed connection")
 			return
 
+		case evt := <-sub.events:
+			s.send(wf, evt.name, evt.data)
+
 		case <-time.After(15 * time.Second):
-			// Send next count
+			// Keep the connection open
 			s.send(wf, "comment", "")
 		}
 	}
 }
 
-func (s *subHandler) MessageHandler(w http.ResponseWriter, r *http.Request) {
-	// Convert ResponseWriter to a writeFlusher
-	wf, ok := w.(writeFlusher)
-	if !ok {
-		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
-		return
+// HandleSubscribe answers a GET with mode=subscribe. It sends the current state of the
+// document, or of every document in the collection, and then each change as it happens.
+// It is called holding ds.mu for reading, and calls release once the current state is read.
+func (ds *DatabaseService) HandleSubscribe(w http.ResponseWriter, r *http.Request, pathParts []string, item PathItem, release func()) {
+	path := pathKey(pathParts)
+	sub := ds.subs.subscribe(path)
+	defer ds.subs.unsubscribe(path, sub)
+
+	var initial []subEvent
+	switch item := item.(type) {
+	case *Document:
+		data, err := item.Marshal()
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+			return
+		}
+		initial = append(initial, subEvent{name: "update", data: string(data)})
+	case *Collection:
+		query, err := parseCollectionQuery(r.URL.Query())
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, jsonString(err.Error()))
+			return
+		}
+		err = query.run(r.Context(), item, func(doc *Document) bool {
+			data, err := doc.Marshal()
+			if err == nil {
+				initial = append(initial, subEvent{name: "update", data: string(data)})
+			}
+			return true
+		})
+		if err != nil {
+			return
+		}
 	}
+	release()
+
+	ds.subs.serve(w, r, sub, initial)
+}
 
-	switch r.Method {
-	case http.MethodDelete:
-		//Delete has been called in or on something in the path
-		slog.Info("Delete called on" + r.URL.Path)
-
-		data := r.URL.Path
-
-		s.send(wf, "delete", data)
-	case http.MethodPost:
-		//Collection only, someone posted to this collection
-		slog.Info("Post called on" + r.URL.Path)
-		s.send(wf, "update", r.URL.Path)
-	case http.MethodPatch:
-		//Document is updated
-		slog.Info("Patch called on" + r.URL.Path)
-		s.send(wf, "update", r.URL.Path)
-	case http.MethodPut:
-		//Document is created or replaced at Path
-		slog.Info("Put called on" + r.URL.Path)
-		s.send(wf, "update", r.URL.Path)
+// notifyUpdate tells the subscribers of a document, and of the collection holding it,
+// that the document was created or changed.
+func (ds *DatabaseService) notifyUpdate(pathParts []string, doc *Document) {
+	data, err := doc.Marshal()
+	if err != nil {
+		slog.Error("Unable to marshal document for subscribers", "error", err)
+		return
 	}
+	ds.subs.publish("update", string(data), pathKey(pathParts), pathKey(pathParts[:len(pathParts)-1]))
+}
+
+// notifyDelete tells the subscribers of a deleted document or collection, of everything
+// nested inside it and of its parent, that it was deleted.
+func (ds *DatabaseService) notifyDelete(pathParts []string) {
+	path := pathKey(pathParts)
+	ds.subs.publishTree("delete", jsonString(path), path)
+	ds.subs.publish("delete", jsonString(path), pathKey(pathParts[:len(pathParts)-1]))
+}
+
+// notifySubtreeUpdate tells the subscribers of every document nested under doc, which is
+// stored at pathParts, and of the collections holding them, that the documents were
+// created or changed. The caller must hold ds.mu.
+func (ds *DatabaseService) notifySubtreeUpdate(ctx context.Context, pathParts []string, doc *Document) {
+	doc.Collections.Scan(ctx, "", "", func(c skiplist.Pair[string, *Collection]) bool {
+		c.Value.Documents.Scan(ctx, "", "", func(nested skiplist.Pair[string, *Document]) bool {
+			nestedParts := append(append([]string{}, pathParts...), c.Key, nested.Key)
+			ds.notifyUpdate(nestedParts, nested.Value)
+			ds.notifySubtreeUpdate(ctx, nestedParts, nested.Value)
+			return true
+		})
+		return true
+	})
+}
+
+// notifyCollectionsDelete tells the subscribers of every collection of doc, which was
+// stored at pathParts and has been replaced, and of everything nested inside them, that
+// they were deleted. The caller must hold ds.mu.
+func (ds *DatabaseService) notifyCollectionsDelete(ctx context.Context, pathParts []string, doc *Document) {
+	doc.Collections.Scan(ctx, "", "", func(c skiplist.Pair[string, *Collection]) bool {
+		path := pathKey(append(append([]string{}, pathParts...), c.Key))
+		ds.subs.publishTree("delete", jsonString(path), path)
+		return true
+	})
 }
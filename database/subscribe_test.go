@@ -0,0 +1,103 @@
+package database
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// nextEvent returns the event waiting for the subscriber, failing the test if there is none.
+func nextEvent(t *testing.T, sub *subscriber) subEvent {
+	t.Helper()
+	select {
+	case evt := <-sub.events:
+		return evt
+	default:
+		t.Fatal("Expected an event")
+		return subEvent{}
+	}
+}
+
+// expectNoEvent fails the test if an event is waiting for the subscriber.
+func expectNoEvent(t *testing.T, sub *subscriber) {
+	t.Helper()
+	select {
+	case evt := <-sub.events:
+		t.Fatalf("Unexpected event %v", evt)
+	default:
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"a":1,"b":{"c":2,"d":3},"e":[1,2]}`, http.StatusCreated)
+
+	r := newRequest("alice", http.MethodPatch, "/v1/db/d", `{"a":null,"b":{"c":5},"e":[3],"f":"new"}`)
+	r.Header.Set("Content-Type", mergePatchMediaType)
+	if w := serve(ds, r); w.Code != http.StatusOK {
+		t.Fatalf("Merge patch failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	want := map[string]any{"b": map[string]any{"c": 5.0, "d": 3.0}, "e": []any{3.0}, "f": "new"}
+	if got := documentData(t, ds, "alice", "/v1/db/d"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merged document is %v, want %v", got, want)
+	}
+}
+
+func TestMergePatchDoesNotModifyTarget(t *testing.T) {
+	target := map[string]any{"a": map[string]any{"b": 1.0}}
+	merged, err := applyMergePatch(target, map[string]any{"a": map[string]any{"b": nil, "c": 2.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"a": map[string]any{"c": 2.0}}; !reflect.DeepEqual(merged, want) {
+		t.Errorf("Merged value is %v, want %v", merged, want)
+	}
+	if want := map[string]any{"a": map[string]any{"b": 1.0}}; !reflect.DeepEqual(target, want) {
+		t.Errorf("Target was modified to %v", target)
+	}
+}
+
+func TestSubscribersSeeUpdates(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	docSub := ds.subs.subscribe("/v1/db/d")
+	collectionSub := ds.subs.subscribe("/v1/db")
+	otherSub := ds.subs.subscribe("/v1/db/other")
+
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"a":1}`, http.StatusCreated)
+	if evt := nextEvent(t, docSub); evt.name != "update" {
+		t.Errorf("Document subscriber got %q, want update", evt.name)
+	}
+	if evt := nextEvent(t, collectionSub); evt.name != "update" {
+		t.Errorf("Collection subscriber got %q, want update", evt.name)
+	}
+	expectNoEvent(t, otherSub)
+}
+
+func TestDeleteNotifiesNestedSubscribers(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/c/x", `{}`, http.StatusCreated)
+
+	nested := ds.subs.subscribe("/v1/db/d/c/x")
+	collection := ds.subs.subscribe("/v1/db/d/c")
+
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db", "", http.StatusNoContent)
+	for _, sub := range []*subscriber{nested, collection} {
+		if evt := nextEvent(t, sub); evt.name != "delete" || evt.data != `"/v1/db"` {
+			t.Errorf("Nested subscriber got %v, want the deletion of /v1/db", evt)
+		}
+	}
+
+	// Deleting /v1/db/d must not reach /v1/db/dd, which only shares a prefix of its name.
+	ds2 := newTestService(t)
+	mustDo(t, ds2, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds2, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	sibling := ds2.subs.subscribe("/v1/db/dd")
+	mustDo(t, ds2, "alice", http.MethodDelete, "/v1/db/d", "", http.StatusNoContent)
+	expectNoEvent(t, sibling)
+}
@@ -0,0 +1,389 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A txOperation is one write of a transaction. Paths are relative to the database, such
+// as /accounts/alice. Put takes a value, patch takes a JSON Patch document, and any
+// operation may carry a precondition on the document it writes.
+type txOperation struct {
+	Op        string          `json:"op"` // put, patch or delete
+	Path      string          `json:"path"`
+	Value     json.RawMessage `json:"value"`
+	Patch     []jsonPatchOp   `json:"patch"`
+	IfMatch   string          `json:"ifMatch"`
+	IfVersion *uint64         `json:"ifVersion"`
+}
+
+// A stagedWrite is the pending state of one document written by a transaction. Doc is
+// nil if the transaction deletes the document.
+type stagedWrite struct {
+	pathParts  []string
+	collection *Collection
+	doc        *Document
+	replaced   bool // Whether the document's collections are dropped, by a put or a delete
+}
+
+// A txEvent is the write event of one staged operation, which is passed to the triggers
+// once every operation has been staged.
+type txEvent struct {
+	index int // Index of the operation in the transaction
+	event WriteEvent
+	doc   *Document // The document the operation writes, nil for a delete
+}
+
+// A txResult describes one operation of a committed transaction.
+type txResult struct {
+	Op      string    `json:"op"`
+	URI     string    `json:"uri"`
+	ETag    string    `json:"etag,omitempty"`
+	created bool      // Whether the operation created the document
+	doc     *Document // The document the operation wrote, nil for a delete
+}
+
+// A txFailure reports the operation that aborted a transaction.
+type txFailure struct {
+	Index   int    `json:"index"`
+	Op      string `json:"op"`
+	Path    string `json:"path"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// A txChange is one document change in the change feed entry of a transaction.
+type txChange struct {
+	Op  string    `json:"op"` // update or delete
+	URI string    `json:"uri"`
+	Doc *Document `json:"doc,omitempty"`
+}
+
+// A transaction stages the writes of a request so that they can be checked as a whole
+// before any of them is applied. Later operations see the staged results of earlier ones.
+type transaction struct {
+	ds       *DatabaseService
+	database string
+	user     string
+	staged   map[string]*stagedWrite
+	order    []string  // Staged paths in the order they were first written
+	events   []txEvent // Events of the staged operations, in order
+}
+
+// precondition returns the check described by the operation, or nil if it has none.
+// IfVersion 0 means that the document must not exist yet.
+func (op txOperation) precondition() precondition {
+	if op.IfMatch == "" && op.IfVersion == nil {
+		return nil
+	}
+	return func(current *Document, exists bool) error {
+		if op.IfMatch != "" && !(exists && etagMatches([]string{op.IfMatch}, current)) {
+			return errPreconditionFailed
+		}
+		if op.IfVersion != nil {
+			version := *op.IfVersion
+			if version == 0 && exists || version != 0 && (!exists || current.Version != version) {
+				return errPreconditionFailed
+			}
+		}
+		return nil
+	}
+}
+
+// current returns the document at the path as the transaction sees it.
+func (tx *transaction) current(key string, c *Collection, name string) (*Document, bool) {
+	if write, ok := tx.staged[key]; ok {
+		return write.doc, write.doc != nil
+	}
+	return c.Documents.Find(name)
+}
+
+// replacedAncestor reports whether the transaction deletes or puts a document the path is
+// nested under. Either drops the document's collections, so the path no longer exists.
+func (tx *transaction) replacedAncestor(key string) bool {
+	for path, write := range tx.staged {
+		if write.replaced && strings.HasPrefix(key, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writesBeneath reports whether the transaction writes a document nested under the path.
+func (tx *transaction) writesBeneath(key string) bool {
+	for path := range tx.staged {
+		if strings.HasPrefix(path, key+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stage checks one operation against the state left by the earlier ones and records its
+// result. If it fails, it returns the HTTP status and error that abort the transaction.
+// The pre-write triggers do not run until every operation has been staged.
+func (tx *transaction) stage(index int, op txOperation) (txResult, int, error) {
+	pathParts, err := splitPath("/v1/" + tx.database + "/" + strings.TrimPrefix(op.Path, "/"))
+	if err != nil {
+		return txResult{}, http.StatusBadRequest, err
+	}
+	if len(pathParts)%2 == 0 {
+		return txResult{}, http.StatusBadRequest, errors.New("path must name a document")
+	}
+	key := pathKey(pathParts)
+	if !tx.ds.allowed(tx.user, key, roleWriter) {
+		return txResult{}, http.StatusForbidden, errors.New("Access denied")
+	}
+	if tx.replacedAncestor(key) {
+		return txResult{}, http.StatusNotFound, errors.New("Collection does not exist")
+	}
+	parent, exists := tx.ds.findItem(pathParts[:len(pathParts)-1])
+	if !exists {
+		return txResult{}, http.StatusNotFound, errors.New("Collection does not exist")
+	}
+	c := parent.(*Collection)
+	name := pathParts[len(pathParts)-1]
+
+	current, exists := tx.current(key, c, name)
+	if check := op.precondition(); check != nil {
+		if err := check(current, exists); err != nil {
+			return txResult{}, http.StatusPreconditionFailed, err
+		}
+	}
+	if owner := tx.ds.ownerCheck(pathParts, tx.user); owner != nil {
+		if err := owner(current, exists); err != nil {
+			return txResult{}, http.StatusForbidden, err
+		}
+	}
+
+	var doc *Document
+	switch op.Op {
+	case "put":
+		if len(op.Value) == 0 || tx.ds.schemaValidator.ValidateData(op.Value) != nil {
+			return txResult{}, http.StatusBadRequest, errors.New("Invalid JSON format")
+		}
+		var data any
+		if err := json.Unmarshal(op.Value, &data); err != nil {
+			return txResult{}, http.StatusBadRequest, err
+		}
+		doc = NewDocument("/"+name, data, tx.user, time.Now(), key)
+		if exists {
+			doc.Metadata.keepCreation(current.Metadata)
+			doc.Metadata.keepLabels(current.Metadata)
+		}
+	case "patch":
+		if !exists {
+			return txResult{}, http.StatusNotFound, errors.New("Document does not exist")
+		}
+		data, err := applyJSONPatch(current.Data, op.Patch)
+		if errors.Is(err, errPatchTestFailed) || errors.Is(err, errPointerNotFound) {
+			return txResult{}, http.StatusConflict, err
+		}
+		if err != nil {
+			return txResult{}, http.StatusBadRequest, err
+		}
+		body, err := json.Marshal(data)
+		if err != nil {
+			return txResult{}, http.StatusBadRequest, err
+		}
+		if tx.ds.schemaValidator.ValidateData(body) != nil {
+			return txResult{}, http.StatusBadRequest, errSchemaMismatch
+		}
+		// Documents are replaced rather than modified in place.
+		updated := *current
+		updated.Data = data
+		updated.Metadata.modified(tx.user, time.Now())
+		doc = &updated
+	case "delete":
+		if !exists {
+			return txResult{}, http.StatusNotFound, errors.New("Document does not exist")
+		}
+	default:
+		return txResult{}, http.StatusBadRequest, fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	// A put or delete drops the collections of an existing document, and with them any
+	// earlier write of the transaction beneath it.
+	replaced := exists && op.Op != "patch"
+	if replaced && tx.writesBeneath(key) {
+		return txResult{}, http.StatusConflict, errors.New("Document holds documents written earlier in the transaction")
+	}
+
+	event := WriteEvent{Path: key, User: tx.user, Delete: doc == nil}
+	if doc != nil {
+		event.Data = doc.Data
+	}
+	if exists {
+		event.Previous = current.Data
+	}
+	tx.events = append(tx.events, txEvent{index: index, event: event, doc: doc})
+
+	// Later preconditions in the transaction compare against the staged version.
+	if doc != nil {
+		doc.Version = nextVersion()
+	}
+	if _, ok := tx.staged[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	if write, ok := tx.staged[key]; ok {
+		replaced = replaced || write.replaced
+	}
+	tx.staged[key] = &stagedWrite{pathParts: pathParts, collection: c, doc: doc, replaced: replaced}
+
+	return txResult{Op: op.Op, URI: key, created: doc != nil && !exists, doc: doc}, http.StatusOK, nil
+}
+
+// runTriggers passes the event of every staged operation, in order, to the pre-write
+// triggers, and writes the data they return into the staged documents. It runs only once
+// every operation has been staged, so no trigger sees a transaction that a later
+// operation would have aborted. A trigger sees the data of its own operation, computed
+// from the data earlier operations staged before their triggers ran. If a trigger rejects
+// a write, runTriggers returns the index of its operation and the error.
+func (tx *transaction) runTriggers() (int, error) {
+	for i := range tx.events {
+		staged := &tx.events[i]
+		if err := tx.ds.beforeWrite(&staged.event); err != nil {
+			return staged.index, err
+		}
+		if staged.doc != nil {
+			staged.doc.Data = staged.event.Data
+		}
+	}
+	return 0, nil
+}
+
+// commit applies every staged write and publishes them as a single change feed entry to
+// the subscribers of each written document and of its collection. A transaction of a
+// single write is published like any other write of that document. Every write was
+// checked when it was staged and is stored without a precondition, so commit cannot fail
+// part way through.
+func (tx *transaction) commit() {
+	var changes []txChange
+	var paths []string
+	notified := make(map[string]bool)
+	for _, key := range tx.order {
+		write := tx.staged[key]
+		name := write.pathParts[len(write.pathParts)-1]
+		if write.doc == nil {
+			write.collection.removeDocument(name, tx.user)
+			changes = append(changes, txChange{Op: "delete", URI: key})
+		} else {
+			// Without a precondition, storing a document cannot fail.
+			write.collection.storeDocument(name, write.doc, nil)
+			changes = append(changes, txChange{Op: "update", URI: key, Doc: write.doc})
+		}
+		for _, path := range []string{key, pathKey(write.pathParts[:len(write.pathParts)-1])} {
+			if !notified[path] {
+				notified[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	for _, staged := range tx.events {
+		tx.ds.afterWrite(staged.event)
+	}
+
+	if len(tx.order) == 1 {
+		write := tx.staged[tx.order[0]]
+		if write.doc == nil {
+			tx.ds.notifyDelete(write.pathParts)
+		} else {
+			tx.ds.notifyUpdate(write.pathParts, write.doc)
+		}
+		return
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		slog.Error("Unable to marshal transaction for subscribers", "error", err)
+		return
+	}
+	tx.ds.subs.publish("transaction", string(data), paths...)
+}
+
+// HandleTransaction answers POST /v1/{db}/_transaction. The body is a list of put, patch
+// and delete operations on documents of the database, which are applied all or nothing.
+// The database lock is held for the whole transaction, so no other writer can interleave.
+func (ds *DatabaseService) HandleTransaction(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	pathParts, err := splitPath(path)
+	if err != nil || len(pathParts) != 2 {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Transactions are only supported on a database\"")
+		return
+	}
+
+	var ops []txOperation
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "\"Failed to decode request body\"")
+		return
+	}
+
+	// Lock the database.
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, exists := ds.collections.Find(pathParts[1]); !exists {
+		sendErrorResponse(w, http.StatusNotFound, "\"Database does not exist\"")
+		return
+	}
+
+	user, _ := ds.auth.Username(r.Header.Get("Authorization"))
+	tx := &transaction{ds: ds, database: pathParts[1], user: user, staged: make(map[string]*stagedWrite)}
+	results := make([]txResult, len(ops))
+	for i, op := range ops {
+		result, status, err := tx.stage(i, op)
+		if err != nil {
+			sendTxFailure(w, i, op, status, err)
+			return
+		}
+		results[i] = result
+	}
+	if i, err := tx.runTriggers(); err != nil {
+		sendTxFailure(w, i, ops[i], http.StatusBadRequest, err)
+		return
+	}
+
+	tx.commit()
+
+	// Documents get their versions when they are stored.
+	for i := range results {
+		if results[i].doc != nil {
+			results[i].ETag = results[i].doc.ETag()
+		}
+	}
+
+	response, err := json.Marshal(struct {
+		Committed bool       `json:"committed"`
+		Results   []txResult `json:"results"`
+	}{Committed: true, Results: results})
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// sendTxFailure reports that the operation at index i aborted the transaction.
+func sendTxFailure(w http.ResponseWriter, i int, op txOperation, status int, err error) {
+	report := struct {
+		Committed bool      `json:"committed"`
+		Failed    txFailure `json:"failed"`
+	}{
+		Failed: txFailure{Index: i, Op: op.Op, Path: op.Path, Status: status, Message: err.Error()},
+	}
+	response, err := json.Marshal(report)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, jsonString(err.Error()))
+		return
+	}
+	sendErrorResponse(w, status, string(response))
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// A txReport is the response to a transaction.
+type txReport struct {
+	Committed bool `json:"committed"`
+	Results   []struct {
+		Op   string `json:"op"`
+		URI  string `json:"uri"`
+		ETag string `json:"etag"`
+	} `json:"results"`
+	Failed txFailure `json:"failed"`
+}
+
+func TestTransactionCommits(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/gone", `{}`, http.StatusCreated)
+
+	var report txReport
+	decode(t, mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"put","path":"/a","value":{"n":1}},
+		{"op":"patch","path":"/a","patch":[{"op":"replace","path":"/n","value":2}]},
+		{"op":"delete","path":"/gone"}
+	]`, http.StatusOK), &report)
+	if !report.Committed || len(report.Results) != 3 {
+		t.Fatalf("Expected a committed transaction of 3 results, got %+v", report)
+	}
+
+	if got := documentData(t, ds, "alice", "/v1/db/a"); !reflect.DeepEqual(got, map[string]any{"n": 2.0}) {
+		t.Errorf("Document a is %v, want n=2", got)
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/gone", "", http.StatusNotFound)
+
+	// The ETag of the last write is the one the document is stored with.
+	etag := mustDo(t, ds, "alice", http.MethodGet, "/v1/db/a", "", http.StatusOK).Header().Get("ETag")
+	if report.Results[1].ETag != etag {
+		t.Errorf("Transaction reported ETag %s, document has %s", report.Results[1].ETag, etag)
+	}
+}
+
+func TestTransactionIsAllOrNothing(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/a", `{"n":1}`, http.StatusCreated)
+
+	var report txReport
+	decode(t, mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"put","path":"/a","value":{"n":2}},
+		{"op":"put","path":"/b","value":{}},
+		{"op":"put","path":"/a","value":{"n":3},"ifVersion":0}
+	]`, http.StatusPreconditionFailed), &report)
+	if report.Committed || report.Failed.Index != 2 {
+		t.Fatalf("Expected operation 2 to abort the transaction, got %+v", report)
+	}
+	if got := documentData(t, ds, "alice", "/v1/db/a"); !reflect.DeepEqual(got, map[string]any{"n": 1.0}) {
+		t.Errorf("Aborted transaction changed a to %v", got)
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/b", "", http.StatusNotFound)
+}
+
+// TestTransactionWriteUnderReplacedDocument checks that a transaction cannot write beneath
+// a document it puts again, since the put drops the document's collections.
+func TestTransactionWriteUnderReplacedDocument(t *testing.T) {
+	ds := newTestService(t)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/sub/", "", http.StatusCreated)
+
+	var report txReport
+	decode(t, mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"put","path":"/d","value":{"v":2}},
+		{"op":"put","path":"/d/sub/x","value":{}}
+	]`, http.StatusNotFound), &report)
+	if report.Committed || report.Failed.Index != 1 {
+		t.Fatalf("Expected the write beneath the replaced document to fail, got %+v", report)
+	}
+
+	// The other order would lose the nested write when the document is replaced.
+	decode(t, mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"put","path":"/d/sub/x","value":{}},
+		{"op":"put","path":"/d","value":{"v":2}}
+	]`, http.StatusConflict), &report)
+	if report.Committed || report.Failed.Index != 1 {
+		t.Fatalf("Expected replacing a document holding a staged write to fail, got %+v", report)
+	}
+
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d/sub/x", "", http.StatusNotFound)
+	if got := documentData(t, ds, "alice", "/v1/db/d"); len(got) != 0 {
+		t.Errorf("Aborted transactions changed d to %v", got)
+	}
+
+	// Patches keep the document's collections, so writes beneath a patched document work.
+	mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"patch","path":"/d","patch":[{"op":"add","path":"/v","value":3}]},
+		{"op":"put","path":"/d/sub/x","value":{}}
+	]`, http.StatusOK)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d/sub/x", "", http.StatusOK)
+}
+
+// TestTransactionTriggersRunAfterStaging checks that pre-write triggers only see a
+// transaction once every operation has been staged, and that a rejection aborts it.
+func TestTransactionTriggersRunAfterStaging(t *testing.T) {
+	var seen []string
+	count := funcTrigger{before: func(event WriteEvent) (any, error) {
+		seen = append(seen, event.Path)
+		if event.Data.(map[string]any)["bad"] == true {
+			return nil, errors.New("rejected")
+		}
+		return event.Data, nil
+	}}
+	ds := newTestService(t, TriggerRegistration{Pattern: "/v1/db", Trigger: count})
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	seen = nil
+
+	var report txReport
+	decode(t, mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"put","path":"/a","value":{}},
+		{"op":"patch","path":"/missing","patch":[]}
+	]`, http.StatusNotFound), &report)
+	if report.Failed.Index != 1 || len(seen) != 0 {
+		t.Errorf("Aborted transaction failed at %d after triggers saw %v, want 1 after none", report.Failed.Index, seen)
+	}
+
+	decode(t, mustDo(t, ds, "alice", http.MethodPost, "/v1/db/_transaction", `[
+		{"op":"put","path":"/a","value":{}},
+		{"op":"put","path":"/b","value":{"bad":true}}
+	]`, http.StatusBadRequest), &report)
+	if report.Committed || report.Failed.Index != 1 {
+		t.Errorf("Expected the trigger to reject operation 1, got %+v", report)
+	}
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/a", "", http.StatusNotFound)
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path"
+)
+
+// A WriteEvent describes a write of a document to the triggers registered for it.
+type WriteEvent struct {
+	Path     string // Full path of the document, such as /v1/db/accounts/alice
+	User     string // User making the write
+	Data     any    // Data being written, nil for a delete
+	Previous any    // Data before the write, nil if the document is being created
+	Delete   bool   // Whether the document is being deleted
+}
+
+// A Trigger runs server-side logic around document writes.
+//
+// BeforeWrite is called before a document is stored or deleted, while writers are
+// blocked, and must return quickly. It returns the data to store, which may be a changed
+// copy of event.Data, or an error that rejects the write. The data it returns for a
+// delete is ignored. In a transaction, BeforeWrite is only called once every operation
+// has been checked, but a later trigger may still reject the transaction, so it should
+// not have side effects that AfterWrite could have instead. AfterWrite is called on its
+// own goroutine once the write is stored.
+// Neither may modify event.Previous, which is the stored data of the document.
+type Trigger interface {
+	BeforeWrite(event WriteEvent) (any, error)
+	AfterWrite(event WriteEvent)
+}
+
+// A TriggerRegistration applies a trigger to the documents matching a path pattern. The
+// pattern uses the syntax of path.Match and matches either the full path of a document
+// or the path of the collection holding it, so /v1/db/accounts applies to every document
+// in that collection and /v1/*/accounts/* to every account document of every database.
+type TriggerRegistration struct {
+	Pattern string
+	Trigger Trigger
+}
+
+// errTriggerSchemaMismatch is returned when a trigger produces data that does not conform
+// to the schema.
+var errTriggerSchemaMismatch = errors.New("Trigger produced data that does not conform to the schema")
+
+// A triggerRejection is the error of a write rejected by a pre-write trigger.
+type triggerRejection struct {
+	err error
+}
+
+func (e triggerRejection) Error() string { return e.err.Error() }
+func (e triggerRejection) Unwrap() error { return e.err }
+
+// matchingTriggers returns the triggers that apply to the document, in registration order.
+func (ds *DatabaseService) matchingTriggers(documentPath string) []Trigger {
+	collectionPath := path.Dir(documentPath)
+	var triggers []Trigger
+	for _, registration := range ds.triggers {
+		matchesDocument, _ := path.Match(registration.Pattern, documentPath)
+		matchesCollection, _ := path.Match(registration.Pattern, collectionPath)
+		if matchesDocument || matchesCollection {
+			triggers = append(triggers, registration.Trigger)
+		}
+	}
+	return triggers
+}
+
+// beforeWrite runs the pre-write triggers of the document in order, each seeing the data
+// returned by the one before, and stores the final data in event.Data. Data changed by a
+// trigger is validated against the schema again. A rejected write returns a
+// triggerRejection. The caller must hold ds.mu.
+func (ds *DatabaseService) beforeWrite(event *WriteEvent) error {
+	triggers := ds.matchingTriggers(event.Path)
+	if len(triggers) == 0 {
+		return nil
+	}
+	for _, trigger := range triggers {
+		data, err := trigger.BeforeWrite(*event)
+		if err != nil {
+			return triggerRejection{err}
+		}
+		if !event.Delete {
+			event.Data = data
+		}
+	}
+	if event.Delete {
+		return nil
+	}
+	body, err := json.Marshal(event.Data)
+	if err != nil || ds.schemaValidator.ValidateData(body) != nil {
+		return triggerRejection{errTriggerSchemaMismatch}
+	}
+	return nil
+}
+
+// afterWrite starts the post-write triggers of the document. They run concurrently with
+// later requests, so the event must not be changed afterwards.
+func (ds *DatabaseService) afterWrite(event WriteEvent) {
+	for _, trigger := range ds.matchingTriggers(event.Path) {
+		go func(trigger Trigger) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					slog.Error("Post-write trigger panicked", "path", event.Path, "panic", recovered)
+				}
+			}()
+			trigger.AfterWrite(event)
+		}(trigger)
+	}
+}
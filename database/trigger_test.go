@@ -0,0 +1,108 @@
+package database
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A funcTrigger is a Trigger built from functions, either of which may be nil.
+type funcTrigger struct {
+	before func(WriteEvent) (any, error)
+	after  func(WriteEvent)
+}
+
+func (f funcTrigger) BeforeWrite(event WriteEvent) (any, error) {
+	if f.before == nil {
+		return event.Data, nil
+	}
+	return f.before(event)
+}
+
+func (f funcTrigger) AfterWrite(event WriteEvent) {
+	if f.after != nil {
+		f.after(event)
+	}
+}
+
+// stamp returns a trigger that sets the key to the value in the object being written.
+func stamp(key string, value any) funcTrigger {
+	return funcTrigger{before: func(event WriteEvent) (any, error) {
+		data := make(map[string]any)
+		for k, v := range event.Data.(map[string]any) {
+			data[k] = v
+		}
+		data[key] = value
+		return data, nil
+	}}
+}
+
+func TestBeforeWriteChangesData(t *testing.T) {
+	ds := newTestService(t,
+		TriggerRegistration{Pattern: "/v1/db/d/orders", Trigger: stamp("status", "new")},
+		TriggerRegistration{Pattern: "/v1/*/d/orders/*", Trigger: stamp("status", "checked")},
+		TriggerRegistration{Pattern: "/v1/db/d/orders/special", Trigger: stamp("special", true)},
+	)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/orders/", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/orders/a", `{"n":1}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d/orders/special", `{"n":2}`, http.StatusCreated)
+
+	// Triggers run in registration order, each seeing the data of the one before.
+	if got := documentData(t, ds, "alice", "/v1/db/d/orders/a"); !reflect.DeepEqual(got, map[string]any{"n": 1.0, "status": "checked"}) {
+		t.Errorf("Document a is %v", got)
+	}
+	if got := documentData(t, ds, "alice", "/v1/db/d/orders/special"); !reflect.DeepEqual(got, map[string]any{"n": 2.0, "status": "checked", "special": true}) {
+		t.Errorf("Document special is %v", got)
+	}
+}
+
+func TestBeforeWriteRejects(t *testing.T) {
+	reject := funcTrigger{before: func(event WriteEvent) (any, error) {
+		if event.Delete || event.Data.(map[string]any)["ok"] != true {
+			return nil, errors.New("rejected")
+		}
+		return event.Data, nil
+	}}
+	ds := newTestService(t, TriggerRegistration{Pattern: "/v1/db", Trigger: reject})
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{}`, http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d", "", http.StatusNotFound)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"ok":true}`, http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodDelete, "/v1/db/d", "", http.StatusBadRequest)
+	mustDo(t, ds, "alice", http.MethodGet, "/v1/db/d", "", http.StatusOK)
+}
+
+func TestAfterWrite(t *testing.T) {
+	events := make(chan WriteEvent, 10)
+	record := funcTrigger{after: func(event WriteEvent) { events <- event }}
+	crash := funcTrigger{after: func(WriteEvent) { panic("trigger bug") }}
+	ds := newTestService(t,
+		TriggerRegistration{Pattern: "/v1/db", Trigger: crash},
+		TriggerRegistration{Pattern: "/v1/db", Trigger: record},
+	)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db", "", http.StatusCreated)
+	mustDo(t, ds, "alice", http.MethodPut, "/v1/db/d", `{"n":1}`, http.StatusCreated)
+	mustDo(t, ds, "bob", http.MethodDelete, "/v1/db/d", "", http.StatusNoContent)
+
+	// Post-write triggers run on their own goroutines, so their events may arrive in any
+	// order.
+	want := map[string]WriteEvent{
+		"alice": {Path: "/v1/db/d", User: "alice", Data: map[string]any{"n": 1.0}},
+		"bob":   {Path: "/v1/db/d", User: "bob", Previous: map[string]any{"n": 1.0}, Delete: true},
+	}
+	for range want {
+		select {
+		case event := <-events:
+			if !reflect.DeepEqual(event, want[event.User]) {
+				t.Errorf("Post-write trigger saw %+v, want %+v", event, want[event.User])
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Post-write trigger was not called")
+		}
+	}
+}
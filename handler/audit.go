@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/audit"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/authorization"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/database"
+)
+
+// A statusRecorder remembers the status and body size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(body []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(body)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes flushes through, so that streamed responses and subscriptions still work.
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// auditRequests records every authenticated request passed to next in the log, and every
+// login, under the user logging in. The document version is read just before and just
+// after the request, so a concurrent write to the same document may be attributed to it.
+func auditRequests(log *audit.Log, auth *authorization.AuthHandler, ds *database.DatabaseService, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.Username(r.Header.Get("Authorization"))
+		if !ok {
+			user, ok = loginUser(r)
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		entry := audit.Entry{
+			Time:          time.Now(),
+			User:          user,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			VersionBefore: ds.DocumentVersion(r.URL.Path),
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		entry.Status = rec.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Bytes = rec.bytes
+		entry.VersionAfter = ds.DocumentVersion(r.URL.Path)
+		if err := log.Record(entry); err != nil {
+			slog.Error("Unable to record audit entry", "error", err)
+		}
+	})
+}
+
+// loginUser returns the user a POST to /auth logs in as. The body is read and put back
+// for the handler. The second return value is false for any other request.
+func loginUser(r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost || r.URL.Path != "/auth" || r.Body == nil {
+		return "", false
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", false
+	}
+	var login authorization.UserFormat
+	if json.Unmarshal(body, &login) != nil || login.Username == "" {
+		return "", false
+	}
+	return login.Username, true
+}
+
+// handleAudit answers GET /_audit, which returns the audit entries selected by the user,
+// path and since parameters. Since is a time in RFC 3339 format or in milliseconds since
+// the Unix epoch. The log covers every database, so only admins of /v1 may read it.
+func handleAudit(log *audit.Log, auth *authorization.AuthHandler, ds *database.DatabaseService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		user, ok := auth.Username(r.Header.Get("Authorization"))
+		if !ok {
+			w.Header().Add("WWW-Authenticate", "Bearer")
+			http.Error(w, `"Missing or invalid bearer token"`, http.StatusUnauthorized)
+			return
+		}
+		if !ds.IsAdmin(user, "/v1") {
+			http.Error(w, `"Only admins may read the audit log"`, http.StatusForbidden)
+			return
+		}
+		if log == nil {
+			http.Error(w, `"Audit log is not enabled"`, http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := audit.Filter{User: query.Get("user"), Path: query.Get("path")}
+		if since := query.Get("since"); since != "" {
+			if millis, err := strconv.ParseInt(since, 10, 64); err == nil {
+				filter.Since = time.UnixMilli(millis)
+			} else if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+				http.Error(w, `"Invalid since time"`, http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := log.Query(filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response, err := json.Marshal(entries)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/audit"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/authorization"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonschema"
+)
+
+// TestMain silences the request logging of the handlers under test.
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newTestHandler returns a server with auditing and access control, whose admin is root.
+// Each of alice, bob and root has the token "token-" and its name.
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	tokens := `{"alice":"token-alice","bob":"token-bob","root":"token-root"}`
+	if err := os.WriteFile(path, []byte(tokens), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auth := authorization.NewAuth()
+	t.Cleanup(auth.Close)
+	if err := auth.LoadTokenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	log, err := audit.Open(filepath.Join(dir, "audit"), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	validator, err := jsonschema.NewSchemaValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(validator, WithAuth(auth), WithAuditLog(log), WithAdmins("root"), WithAccessControl(true))
+}
+
+// send makes a request from the user and returns the recorded response.
+func send(h http.Handler, user string, method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer token-"+user)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// TestAuditReadableByGrantedAdmins checks that users granted admin on every database
+// through /_acl may read the audit log, like the admins the server was started with.
+func TestAuditReadableByGrantedAdmins(t *testing.T) {
+	h := newTestHandler(t)
+	if w := send(h, "root", http.MethodPut, "/v1/db", ""); w.Code != http.StatusCreated {
+		t.Fatalf("Creating the database failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := send(h, "alice", http.MethodGet, "/_audit", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Reading the audit log without admin answered %d, want 403", w.Code)
+	}
+	grants := []string{
+		`{"user":"alice","path":"/v1","role":"admin"}`,
+		`{"user":"bob","path":"/v1/db","role":"admin"}`,
+	}
+	for _, grant := range grants {
+		if w := send(h, "root", http.MethodPut, "/_acl", grant); w.Code != http.StatusNoContent {
+			t.Fatalf("Granting %s failed with %d: %s", grant, w.Code, w.Body.String())
+		}
+	}
+
+	w := send(h, "alice", http.MethodGet, "/_audit?user=root&path=/v1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Reading the audit log as a granted admin answered %d: %s", w.Code, w.Body.String())
+	}
+	var entries []audit.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/v1/db" || entries[0].Status != http.StatusCreated {
+		t.Errorf("Expected root's creation of the database, got %+v", entries)
+	}
+
+	// The log covers every database, so an admin of one of them may not read it.
+	if w := send(h, "bob", http.MethodGet, "/_audit", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Reading the audit log as an admin of one database answered %d, want 403", w.Code)
+	}
+}
+
+// TestAuditCoversEveryRoute checks that requests outside the databases, such as role
+// grants and logins, are recorded too.
+func TestAuditCoversEveryRoute(t *testing.T) {
+	h := newTestHandler(t)
+	grant := `{"user":"alice","path":"/v1/db","role":"writer"}`
+	if w := send(h, "root", http.MethodPut, "/_acl", grant); w.Code != http.StatusNoContent {
+		t.Fatalf("Granting a role failed with %d: %s", w.Code, w.Body.String())
+	}
+	login := httptest.NewRequest(http.MethodPost, "/auth", strings.NewReader(`{"username":"carol"}`))
+	login.Header.Set("Content-Type", "application/json")
+	lw := httptest.NewRecorder()
+	h.ServeHTTP(lw, login)
+	if lw.Code != http.StatusOK {
+		t.Fatalf("Logging in failed with %d: %s", lw.Code, lw.Body.String())
+	}
+
+	w := send(h, "root", http.MethodGet, "/_audit", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Reading the audit log answered %d: %s", w.Code, w.Body.String())
+	}
+	var entries []audit.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	want := []audit.Entry{
+		{User: "root", Method: http.MethodPut, Path: "/_acl", Status: http.StatusNoContent},
+		{User: "carol", Method: http.MethodPost, Path: "/auth", Status: http.StatusOK},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %+v", len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry.User != want[i].User || entry.Method != want[i].Method || entry.Path != want[i].Path || entry.Status != want[i].Status {
+			t.Errorf("Entry %d is %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
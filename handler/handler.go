@@ -4,19 +4,78 @@ import (
 	"net/http"
 
 	// added auth import
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/audit"
 	"github.com/RICE-COMP318-FALL23/owldb-p1group37/authorization"
 	"github.com/RICE-COMP318-FALL23/owldb-p1group37/database"
 	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonschema"
 )
 
-func New(s jsonschema.SchemaValidator) http.Handler {
-	auth := authorization.NewAuth()
-	ds := database.NewDatabaseService(auth, s)
+// options configures the server's handler. The zero value is a server without triggers,
+// auditing or access control, whose tokens are only kept in memory.
+type options struct {
+	auth          *authorization.AuthHandler     // Token store, a new empty one if nil
+	triggers      []database.TriggerRegistration // Called around document writes, as described by database.Trigger
+	auditLog      *audit.Log                     // Records every authenticated request, nil to disable auditing
+	admins        []string                       // Users allowed to read the audit log, and admins of every path
+	accessControl bool                           // Whether requests need a role on their path, granted through /_acl
+}
+
+// An Option configures the handler returned by New.
+type Option func(*options)
+
+// WithAuth makes the handler use the given token store instead of a new empty one.
+func WithAuth(auth *authorization.AuthHandler) Option {
+	return func(o *options) { o.auth = auth }
+}
+
+// WithTriggers adds triggers, which are called around document writes as described by
+// database.Trigger.
+func WithTriggers(triggers ...database.TriggerRegistration) Option {
+	return func(o *options) { o.triggers = append(o.triggers, triggers...) }
+}
+
+// WithAuditLog records every authenticated request in the log, which admins may read
+// through /_audit.
+func WithAuditLog(log *audit.Log) Option {
+	return func(o *options) { o.auditLog = log }
+}
+
+// WithAdmins makes the users admins of every path, who may also read the audit log.
+func WithAdmins(admins ...string) Option {
+	return func(o *options) { o.admins = append(o.admins, admins...) }
+}
+
+// WithAccessControl sets whether requests need a role on their path, granted through /_acl.
+func WithAccessControl(enabled bool) Option {
+	return func(o *options) { o.accessControl = enabled }
+}
+
+// New creates the server's handler. Without options it serves a database without
+// triggers, auditing or access control, whose tokens are only kept in memory.
+func New(s jsonschema.SchemaValidator, opts ...Option) http.Handler {
+	var config options
+	for _, opt := range opts {
+		opt(&config)
+	}
+	auth := config.auth
+	if auth == nil {
+		auth = authorization.NewAuth()
+	}
+	ds := database.NewDatabaseService(auth, s, config.triggers...)
+	ds.SetAdmins(config.admins)
+	if config.accessControl {
+		ds.EnableAccessControl()
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/auth", auth.HandleAuthFunctions)
 	//slog.Info("auth functions handled")
+	mux.HandleFunc("/_audit", handleAudit(config.auditLog, auth, ds))
+	mux.HandleFunc("/_acl", ds.HandleACL)
 	mux.HandleFunc("/", ds.DBMethods)
 
+	if config.auditLog != nil {
+		return auditRequests(config.auditLog, auth, ds, mux)
+	}
 	return mux
 }
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/database"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonschema"
+)
+
+// rejectAll is a trigger that rejects every write.
+type rejectAll struct{}
+
+func (rejectAll) BeforeWrite(event database.WriteEvent) (any, error) {
+	return nil, errRejected
+}
+
+func (rejectAll) AfterWrite(event database.WriteEvent) {}
+
+var errRejected = errors.New("rejected")
+
+// login logs the user in through /auth and returns their token.
+func login(t *testing.T, h http.Handler, user string) string {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/auth", strings.NewReader(`{"username":"`+user+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var body struct {
+		Token string `json:"token"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+		t.Fatalf("Logging in failed with %d: %s", w.Code, w.Body.String())
+	}
+	return body.Token
+}
+
+// put makes a PUT request with the token and returns its status.
+func put(h http.Handler, token string, path string, body string) int {
+	r := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestNewWithoutOptions(t *testing.T) {
+	validator, err := jsonschema.NewSchemaValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(validator)
+	token := login(t, h, "alice")
+	if code := put(h, token, "/v1/db", ""); code != http.StatusCreated {
+		t.Fatalf("Creating a database answered %d", code)
+	}
+	if code := put(h, token, "/v1/db/d", `{}`); code != http.StatusCreated {
+		t.Errorf("Creating a document answered %d", code)
+	}
+}
+
+func TestWithTriggers(t *testing.T) {
+	validator, err := jsonschema.NewSchemaValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(validator, WithTriggers(database.TriggerRegistration{Pattern: "/v1/db/locked", Trigger: rejectAll{}}))
+	token := login(t, h, "alice")
+	if code := put(h, token, "/v1/db", ""); code != http.StatusCreated {
+		t.Fatalf("Creating a database answered %d", code)
+	}
+	if code := put(h, token, "/v1/db/locked", `{}`); code != http.StatusBadRequest {
+		t.Errorf("Write rejected by a trigger answered %d, want 400", code)
+	}
+	if code := put(h, token, "/v1/db/open", `{}`); code != http.StatusCreated {
+		t.Errorf("Write outside the trigger's pattern answered %d", code)
+	}
+}
@@ -10,8 +10,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/audit"
+	"github.com/RICE-COMP318-FALL23/owldb-p1group37/authorization"
 	"github.com/RICE-COMP318-FALL23/owldb-p1group37/handler"
 	"github.com/RICE-COMP318-FALL23/owldb-p1group37/jsonschema"
 )
@@ -32,6 +35,14 @@ func main() {
 	//schemaPtr := flag.String("s", "", "schema file")
 	flag.StringVar(&schemaFilename, "d", "", "JSON Data File")
 	tokenPtr := flag.String("t", "", "token file")
+	tokenStore := flag.String("tokenstore", "", "file the token store is saved to, so tokens survive restarts")
+	jwtSecret := flag.String("jwtsecret", "", "file holding the shared secret of HS256 signed tokens, which are only accepted if set")
+	jwtAudience := flag.String("jwtaudience", "", "audience signed tokens must be issued for")
+	jwtMint := flag.Bool("jwtmint", false, "hand out signed tokens from /auth instead of random ones")
+	auditDir := flag.String("audit", "", "directory of the audit log, auditing is disabled if empty")
+	auditMaxBytes := flag.Int64("audit-max-bytes", 10<<20, "size at which the audit log is rotated")
+	admins := flag.String("admins", "", "comma separated users allowed to read the audit log and administer every path")
+	accessControl := flag.Bool("acl", false, "require users to be granted a role on the paths they use")
 	flag.Parse()
 
 	port = *portPtr
@@ -46,13 +57,47 @@ func main() {
 
 	//slog.Info("Schema validator created", "filename", schemaFilename)
 
-	_ = tokenPtr
+	// Saved tokens are loaded first, so that the token file takes precedence.
+	auth := authorization.NewAuth()
+	defer auth.Close()
+	if *tokenStore != "" {
+		if err := auth.OpenStore(*tokenStore); err != nil {
+			slog.Error("Error opening token store", "error", err)
+			return
+		}
+	}
+	if *jwtSecret != "" {
+		if err := auth.EnableJWT(*jwtSecret, *jwtAudience, *jwtMint); err != nil {
+			slog.Error("Error reading JWT secret", "error", err)
+			return
+		}
+	}
+	if *tokenPtr != "" {
+		if err := auth.LoadTokenFile(*tokenPtr); err != nil {
+			slog.Error("Error loading token file", "error", err)
+			return
+		}
+	}
 
 	// Set server address based on port
 	server.Addr = ":" + fmt.Sprintf("%d", port)
 
+	options := []handler.Option{handler.WithAuth(auth), handler.WithAccessControl(*accessControl)}
+	if *admins != "" {
+		options = append(options, handler.WithAdmins(strings.Split(*admins, ",")...))
+	}
+	if *auditDir != "" {
+		auditLog, err := audit.Open(*auditDir, *auditMaxBytes)
+		if err != nil {
+			slog.Error("Error opening audit log", "error", err)
+			return
+		}
+		defer auditLog.Close()
+		options = append(options, handler.WithAuditLog(auditLog))
+	}
+
 	// Assign the handler to the server
-	server.Handler = handler.New(schemaValidator)
+	server.Handler = handler.New(schemaValidator, options...)
 
 	// The following code should go last and remain unchanged.
 	// Note that you must actually initialize 'server' and 'port'
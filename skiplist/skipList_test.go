@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestUpsertInsert(t *testing.T) {
@@ -115,6 +117,85 @@ func TestRemoveNonExisting(t *testing.T) {
 	}
 }
 
+// TestRemoveReleasesLocks checks that a removal unlocks its predecessors, so that later
+// updates next to the removed key do not block.
+func TestRemoveReleasesLocks(t *testing.T) {
+	sl := NewSkipList[int, string]()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			sl.Upsert(i, func(k int, v string, exists bool) (string, error) {
+				return fmt.Sprint(k), nil
+			})
+			sl.Remove(i)
+			sl.Upsert(i, func(k int, v string, exists bool) (string, error) {
+				return fmt.Sprint(k), nil
+			})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Upsert blocked after Remove")
+	}
+	if _, found := sl.Find(100); !found {
+		t.Error("Expected key 100 to be reinserted")
+	}
+}
+
+// TestUpsertCheckIsAtomic checks that no update is lost when concurrent upserts each
+// increment the value they are given.
+func TestUpsertCheckIsAtomic(t *testing.T) {
+	sl := NewSkipList[int, int]()
+	const numGoroutines, increments = 8, 200
+
+	done := make(chan struct{})
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < increments; j++ {
+				sl.Upsert(1, func(k int, v int, exists bool) (int, error) {
+					// Let other upserts run while this one holds the value it was given.
+					runtime.Gosched()
+					return v + 1, nil
+				})
+			}
+		}()
+	}
+	for i := 0; i < numGoroutines; i++ {
+		<-done
+	}
+
+	if v, _ := sl.Find(1); v != numGoroutines*increments {
+		t.Fatalf("Expected %d after concurrent increments, got %d", numGoroutines*increments, v)
+	}
+}
+
+// TestUpsertInsertCheckFails checks that a rejected insertion leaves the key absent and
+// the list usable.
+func TestUpsertInsertCheckFails(t *testing.T) {
+	sl := NewSkipList[int, string]()
+	rejected := errors.New("rejected")
+
+	_, err := sl.Upsert(1, func(k int, v string, exists bool) (string, error) {
+		return "", rejected
+	})
+	if err != rejected {
+		t.Fatalf("Expected the check's error, got %v", err)
+	}
+	if _, found := sl.Find(1); found {
+		t.Fatal("Expected a rejected key not to be inserted")
+	}
+	if updated, err := sl.Upsert(1, func(k int, v string, exists bool) (string, error) {
+		return "ok", nil
+	}); err != nil || !updated {
+		t.Fatalf("Expected an insert after a rejection to succeed, got %v", err)
+	}
+}
+
 // TestUpsertMultiple will check the ability of the skip list to insert multiple items.
 func TestUpsertMultiple(t *testing.T) {
 	sl := NewSkipList[int, string]()
@@ -334,3 +415,54 @@ func TestQueryWithTimeout(t *testing.T) {
 		t.Fatalf("Expected DeadlineExceeded error, got: %v", err)
 	}
 }
+
+func TestScanStopsEarly(t *testing.T) {
+	sl := NewSkipList[int, string]()
+	ctx := context.TODO()
+
+	for _, key := range []int{1, 2, 3, 4, 5} {
+		sl.Upsert(key, func(k int, v string, exists bool) (string, error) {
+			return fmt.Sprint(k), nil
+		})
+	}
+
+	// Scan the whole list but stop after the second element
+	var visited []int
+	err := sl.Scan(ctx, 0, 0, func(pair Pair[int, string]) bool {
+		visited = append(visited, pair.Key)
+		return len(visited) < 2
+	})
+
+	if err != nil {
+		t.Fatalf("Error during Scan: %v", err)
+	}
+
+	if len(visited) != 2 || visited[0] != 1 || visited[1] != 2 {
+		t.Errorf("Expected to visit [1 2], got %v", visited)
+	}
+}
+
+func TestScanInRange(t *testing.T) {
+	sl := NewSkipList[int, string]()
+	ctx := context.TODO()
+
+	for _, key := range []int{1, 5, 10, 15} {
+		sl.Upsert(key, func(k int, v string, exists bool) (string, error) {
+			return fmt.Sprint(k), nil
+		})
+	}
+
+	var visited []int
+	err := sl.Scan(ctx, 2, 10, func(pair Pair[int, string]) bool {
+		visited = append(visited, pair.Key)
+		return true
+	})
+
+	if err != nil {
+		t.Fatalf("Error during Scan: %v", err)
+	}
+
+	if len(visited) != 2 || visited[0] != 5 || visited[1] != 10 {
+		t.Errorf("Expected to visit [5 10], got %v", visited)
+	}
+}
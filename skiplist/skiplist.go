@@ -22,6 +22,7 @@ type SkipList[K cmp.Ordered, V any] interface {
 	Remove(key K) (removedValue V, removed bool)
 	Find(key K) (foundValue V, found bool)
 	Query(ctx context.Context, start K, end K) (results []Pair[K, V], err error)
+	Scan(ctx context.Context, start K, end K, visit func(Pair[K, V]) bool) (err error)
 }
 
 // Pair is a type that holds a key K and a value V.
@@ -108,39 +109,33 @@ func (sl *SkipListImpl[K, V]) findHelper(key K) (int, []*Node[K, V], []*Node[K,
 }
 
 // Upsert inserts or updates node in the skip list based on the provided check function.
+// The check is called while the node, or the predecessors of a new node, are locked, so
+// the value it is given cannot change before the value it returns is stored.
 func (sl *SkipListImpl[K, V]) Upsert(key K, check UpdateCheck[K, V]) (bool, error) {
 	// Choose a random level as the topLevel to insert (for balancing)
 	topLevel := sl.randomLevel()
 
 	for true {
-		var checkValue V
 		// Check if key is in the list
 		levelFound, preds, succs := sl.findHelper(key)
 		if levelFound != -1 {
 			found := succs[levelFound]
-			checkValue = found.value
-			if found.marked {
-				// Adding node, wait for other operation, and fail
-				for !found.fullyLinked {
+			// Locking the node waits for an insertion of it to finish
+			found.mu.Lock()
+			if !found.marked {
+				// The node was found and is not being removed, so update it
+				value, err := check(key, found.value, true)
+				if err == nil {
+					found.value = value
 				}
-				return false, nil
-			} else {
-				// The node was found and is not inside another operation, so update it
-				value, err := check(key, checkValue, true)
-				if err != nil {
-					return false, err
-				}
-				found.mu.Lock()
-				found.value = value
 				found.mu.Unlock()
-				return true, nil
+				return err == nil, err
 			}
+			// The node is being removed, so try again once it is gone
+			found.mu.Unlock()
+			continue
 		}
 		// Key was not found, so we have to Insert it
-		value, err := check(key, checkValue, levelFound != -1)
-		if err != nil {
-			return false, err
-		}
 		// Lock the predecessors
 		highestLocked := -1
 		valid := true
@@ -163,11 +158,16 @@ func (sl *SkipListImpl[K, V]) Upsert(key K, check UpdateCheck[K, V]) (bool, erro
 		}
 		// If the location became invalid for any reason, unlock and restart
 		if !valid {
-			for level := 0; level <= highestLocked; level++ {
-				preds[level].mu.Unlock()
-			}
+			sl.unlockPreds(preds, highestLocked)
 			continue // Return to start of the loop
 		}
+		// No node with the key can be inserted while the predecessors are locked
+		var zero V
+		value, err := check(key, zero, false)
+		if err != nil {
+			sl.unlockPreds(preds, highestLocked)
+			return false, err
+		}
 		// Create node for insertion
 		node := NewNode(key, value)
 		node.mu.Lock()
@@ -182,15 +182,7 @@ func (sl *SkipListImpl[K, V]) Upsert(key K, check UpdateCheck[K, V]) (bool, erro
 		}
 		// Unlock preds and inserted node
 		node.fullyLinked = true
-		level = highestLocked
-		lastUnlockedNode := (*Node[K, V])(nil) // Initialize to nil. This will hold reference to the last node we unlocked.
-		for level >= 0 {
-			if preds[level] != lastUnlockedNode {
-				preds[level].mu.Unlock()
-				lastUnlockedNode = preds[level] // Update the reference to the last unlocked node
-			}
-			level = level - 1
-		}
+		sl.unlockPreds(preds, highestLocked)
 		node.mu.Unlock()
 		return true, nil
 	}
@@ -252,11 +244,7 @@ func (sl *SkipListImpl[K, V]) Remove(key K) (V, bool) {
 
 		// If the removal was not valid for any reason, unlock locked predecessors and try again
 		if !valid {
-			level = highestLocked
-			for level >= 0 {
-				preds[level].mu.Unlock()
-				level = level - 1
-			}
+			sl.unlockPreds(preds, highestLocked)
 			// Victim remains locked as this removal has ownership
 			continue
 		}
@@ -270,19 +258,25 @@ func (sl *SkipListImpl[K, V]) Remove(key K) (V, bool) {
 
 		// Unlock the victim and the predecessors
 		victim.mu.Unlock()
-		lastUnlockedNode := (*Node[K, V])(nil) // Initialize to nil. This will hold reference to the last node we unlocked.
-		for level >= 0 {
-			if preds[level] != lastUnlockedNode {
-				preds[level].mu.Unlock()
-				lastUnlockedNode = preds[level] // Update the reference to the last unlocked node
-			}
-			level = level - 1
-		}
+		sl.unlockPreds(preds, highestLocked)
 		return victim.value, true
 	}
 	return victim.value, true
 }
 
+// unlockPreds unlocks the predecessors locked on levels 0 through highestLocked.
+// A node that is the predecessor on several adjacent levels was only locked once,
+// so it is only unlocked once.
+func (sl *SkipListImpl[K, V]) unlockPreds(preds []*Node[K, V], highestLocked int) {
+	lastUnlockedNode := (*Node[K, V])(nil)
+	for level := highestLocked; level >= 0; level-- {
+		if preds[level] != lastUnlockedNode {
+			preds[level].mu.Unlock()
+			lastUnlockedNode = preds[level]
+		}
+	}
+}
+
 // randomLevel generates a random level for a new node.
 func (sl *SkipListImpl[K, V]) randomLevel() int {
 	lvl := 1
@@ -295,43 +289,45 @@ func (sl *SkipListImpl[K, V]) randomLevel() int {
 
 // Query returns all elements in the skip list (in order) with keys between start and end inclusive.
 func (sl *SkipListImpl[K, V]) Query(ctx context.Context, start K, end K) ([]Pair[K, V], error) {
-	// Get the first node in the Query.
-	var loopNode *Node[K, V]
-	_, _, firstNodeSuccs := sl.findHelper(start)
-	loopNode = firstNodeSuccs[0]
-	// Get the last node in the Query.
-	var lastNode *Node[K, V]
-	if end == sl.Tail.key {
-		lastNode = sl.Tail
-	} else {
-		_, lastNodePreds, lastNodeSuccs := sl.findHelper(end)
-		if lastNodeSuccs[0] != nil {
-			lastNode = lastNodeSuccs[0]
-		} else {
-			lastNode = lastNodePreds[0]
-		}
+	var results []Pair[K, V]
+	err := sl.Scan(ctx, start, end, func(pair Pair[K, V]) bool {
+		results = append(results, pair)
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
+	return results, nil
+}
 
-	// Loop through the nodes from the start to end node, appending them to results.
-	var results []Pair[K, V]
-	for loopNode != lastNode && !loopNode.isTail {
+// Scan calls visit on each element in the skip list (in order) with keys between start and end inclusive,
+// without collecting them. If end is the zero value of K the scan runs to the end of the list.
+// Scan stops early when visit returns false, and returns the context's error if it is done.
+func (sl *SkipListImpl[K, V]) Scan(ctx context.Context, start K, end K, visit func(Pair[K, V]) bool) error {
+	// Get the first node in the range.
+	_, _, firstNodeSuccs := sl.findHelper(start)
+	loopNode := firstNodeSuccs[0]
+
+	// Walk the bottom level until we pass the end key or reach the tail node.
+	for !loopNode.isTail {
+		if end != sl.Tail.key && cmp.Compare(loopNode.key, end) > 0 {
+			return nil
+		}
 		// Check the context's Done channel to see if the operation should be terminated.
 		select {
 		case <-ctx.Done():
 			// The operation has been canceled or exceeded its timeout.
-			return nil, ctx.Err()
+			return ctx.Err()
 		default:
 			// No cancellation or timeout, continue with the operation.
 		}
-		pair := Pair[K, V]{Key: loopNode.key, Value: loopNode.value}
-		results = append(results, pair)
+		// Skip nodes that are still being inserted or are being removed.
+		if loopNode.fullyLinked && !loopNode.marked {
+			if !visit(Pair[K, V]{Key: loopNode.key, Value: loopNode.value}) {
+				return nil
+			}
+		}
 		loopNode = loopNode.next[0]
 	}
-	// Add the last node only if it is within range and not a tail node
-	if loopNode != sl.Tail && cmp.Compare(loopNode.key, end) <= 0 {
-		pair := Pair[K, V]{Key: loopNode.key, Value: loopNode.value}
-		results = append(results, pair)
-	}
-
-	return results, nil
+	return nil
 }